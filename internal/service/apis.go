@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// apiDefinition is a mock API defined in the APIs file
+type apiDefinition struct {
+	Name string            `json:"name"` // mock API name
+	Env  map[string]string `json:"env"`  // configuration variables (same as the environment variables)
+}
+
+// loadAPIsConfig loads the configuration of the mock APIs defined in a JSON file
+func loadAPIsConfig(path string) ([]*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions []apiDefinition
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&definitions); err != nil {
+		return nil, fmt.Errorf("invalid json format: %w", err)
+	}
+	if len(definitions) == 0 {
+		return nil, fmt.Errorf("no APIs defined")
+	}
+
+	cfgs := make([]*config, 0, len(definitions))
+	names := map[string]bool{}
+	listeners := map[string]string{} // "port/host" -> API name
+	tlsPorts := map[int]*config{}    // TLS port -> first API served on it
+	certDirs := map[string]string{}  // auto-generated certificates directory -> API name
+	for i, def := range definitions {
+		if def.Name == "" {
+			return nil, fmt.Errorf("API %d: name is required", i)
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("API %s: duplicated name", def.Name)
+		}
+		names[def.Name] = true
+
+		cfg, err := loadConfig(func(key string) string { return def.Env[key] })
+		if err != nil {
+			return nil, fmt.Errorf("API %s: %w", def.Name, err)
+		}
+		cfg.name = def.Name
+		// host-based routing only applies to APIs defined in the APIs file, since the
+		// HOST environment variable is often set by container runtimes
+		cfg.host = strings.ToLower(def.Env["HOST"])
+
+		// APIs sharing a port must be served for different hosts
+		ports := []int{cfg.port}
+		if cfg.tlsPort != 0 {
+			ports = append(ports, cfg.tlsPort)
+		}
+		for _, port := range ports {
+			key := fmt.Sprintf("%d/%s", port, cfg.host)
+			if other, found := listeners[key]; found {
+				return nil, fmt.Errorf("APIs %s and %s are both served on port %d for host %q", other, def.Name, port, cfg.host)
+			}
+			listeners[key] = def.Name
+		}
+
+		// APIs sharing a TLS port share the client certificates policy, as the TLS
+		// handshake completes before the request host is known
+		if cfg.tlsPort != 0 {
+			if other, found := tlsPorts[cfg.tlsPort]; !found {
+				tlsPorts[cfg.tlsPort] = cfg
+			} else if other.tlsClientCAFile != cfg.tlsClientCAFile || other.tlsClientAuth != cfg.tlsClientAuth {
+				return nil, fmt.Errorf("APIs %s and %s share TLS port %d with different client certificate settings", other.name, def.Name, cfg.tlsPort)
+			}
+		}
+
+		// APIs generating their certificates write them to their own directory, by
+		// default a subdirectory of the default one named after the API
+		if cfg.tlsAutoCert {
+			if def.Env["TLS_CERT_DIR"] == "" {
+				cfg.tlsCertDir = filepath.Join(defaultTLSDir, def.Name)
+			}
+			dir := filepath.Clean(cfg.tlsCertDir)
+			if other, found := certDirs[dir]; found {
+				return nil, fmt.Errorf("APIs %s and %s both write their certificates to %s", other, def.Name, dir)
+			}
+			certDirs[dir] = def.Name
+		}
+
+		cfgs = append(cfgs, cfg)
+	}
+
+	return cfgs, nil
+}
+
+// hostRouter dispatches requests to the mock API served for the request host,
+// falling back to the mock API served for any host (if any)
+type hostRouter struct {
+	byHost   map[string]http.Handler
+	fallback http.Handler
+}
+
+// newHostRouter creates a router for the mock APIs sharing a port
+func newHostRouter(apis []*service) http.Handler {
+	if len(apis) == 1 && apis[0].cfg.host == "" {
+		return apis[0].router
+	}
+
+	hr := &hostRouter{byHost: map[string]http.Handler{}}
+	for _, api := range apis {
+		if api.cfg.host == "" {
+			hr.fallback = api.router
+		} else {
+			hr.byHost[api.cfg.host] = api.router
+		}
+	}
+
+	return hr
+}
+
+// ServeHTTP implements the http.Handler interface
+func (hr *hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if handler, found := hr.byHost[strings.ToLower(host)]; found {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if hr.fallback != nil {
+		hr.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	renderJSON(w, r, http.StatusMisdirectedRequest, api.MakeHTTPErrorResponse("unknown host "+host, api.CodeNotFound, strconv.FormatUint(rand.Uint64(), 16)))
+}
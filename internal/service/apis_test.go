@@ -0,0 +1,203 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_loadAPIsConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     map[string]string // API name -> URI prefix
+		certDirs map[string]string // API name -> auto-generated certificates directory (if checked)
+		wantErr  bool
+	}{
+		{
+			name: "valid APIs",
+			content: `[
+				{"name": "payments", "env": {"PORT": "8081", "URI_PREFIX": "/payments"}},
+				{"name": "users", "env": {"PORT": "8082"}},
+				{"name": "orders", "env": {"PORT": "8082", "HOST": "orders.test"}}
+			]`,
+			want: map[string]string{"payments": "/payments", "users": "/v1/mock", "orders": "/v1/mock"},
+		},
+		{
+			name:    "no APIs",
+			content: `[]`,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			content: `[{"env": {"PORT": "8081"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "duplicated name",
+			content: `[{"name": "users", "env": {"PORT": "8081"}}, {"name": "users", "env": {"PORT": "8082"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "same port and host",
+			content: `[{"name": "users", "env": {"PORT": "8081"}}, {"name": "orders", "env": {"PORT": "8081"}}]`,
+			wantErr: true,
+		},
+		{
+			name: "same TLS port and client certificate settings",
+			content: `[
+				{"name": "users", "env": {"PORT": "8081", "TLS_AUTO_CERT": "true", "HOST": "users.test", "TLS_CLIENT_CA_FILE": "/certs/ca.crt"}},
+				{"name": "orders", "env": {"PORT": "8082", "TLS_AUTO_CERT": "true", "HOST": "orders.test", "TLS_CLIENT_CA_FILE": "/certs/ca.crt"}}
+			]`,
+			want:     map[string]string{"users": "/v1/mock", "orders": "/v1/mock"},
+			certDirs: map[string]string{"users": filepath.Join("certs", "users"), "orders": filepath.Join("certs", "orders")},
+		},
+		{
+			name: "auto-generated certificates in a custom directory",
+			content: `[
+				{"name": "users", "env": {"PORT": "8081", "TLS_AUTO_CERT": "true", "TLS_PORT": "8444", "TLS_CERT_DIR": "/etc/certs/users"}},
+				{"name": "orders", "env": {"PORT": "8082", "TLS_AUTO_CERT": "true", "TLS_PORT": "8445"}}
+			]`,
+			want:     map[string]string{"users": "/v1/mock", "orders": "/v1/mock"},
+			certDirs: map[string]string{"users": "/etc/certs/users", "orders": filepath.Join("certs", "orders")},
+		},
+		{
+			name: "auto-generated certificates in the same directory",
+			content: `[
+				{"name": "users", "env": {"PORT": "8081", "TLS_AUTO_CERT": "true", "TLS_PORT": "8444", "TLS_CERT_DIR": "/etc/certs"}},
+				{"name": "orders", "env": {"PORT": "8082", "TLS_AUTO_CERT": "true", "TLS_PORT": "8445", "TLS_CERT_DIR": "/etc/certs/"}}
+			]`,
+			wantErr: true,
+		},
+		{
+			name: "same TLS port and different client certificate settings",
+			content: `[
+				{"name": "users", "env": {"PORT": "8081", "TLS_AUTO_CERT": "true", "HOST": "users.test", "TLS_CLIENT_CA_FILE": "/certs/ca.crt"}},
+				{"name": "orders", "env": {"PORT": "8082", "TLS_AUTO_CERT": "true", "HOST": "orders.test"}}
+			]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid API configuration",
+			content: `[{"name": "users", "env": {"PORT": "not-a-port"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			content: `[{"name": "users", "foo": "bar"}]`,
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			path := filepath.Join(tt.TempDir(), "apis.json")
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				tt.Fatal(err)
+			}
+
+			got, err := loadAPIsConfig(path)
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("loadAPIsConfig() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(got) != len(test.want) {
+				tt.Fatalf("loadAPIsConfig() returned %d APIs, want %d", len(got), len(test.want))
+			}
+			for _, cfg := range got {
+				if cfg.uriPrefix != test.want[cfg.name] {
+					tt.Errorf("API %s: got URI prefix %s, want %s", cfg.name, cfg.uriPrefix, test.want[cfg.name])
+				}
+				if test.certDirs != nil && cfg.tlsCertDir != test.certDirs[cfg.name] {
+					tt.Errorf("API %s: got certificates directory %s, want %s", cfg.name, cfg.tlsCertDir, test.certDirs[cfg.name])
+				}
+			}
+		})
+	}
+}
+
+func Test_hostRouter(t *testing.T) {
+	newAPI := func(host, uriPrefix, body string) *service {
+		api := &service{
+			cfg: &config{
+				host:            host,
+				uriPrefix:       uriPrefix,
+				methods:         []string{http.MethodGet},
+				subRoutes:       []string{"/"},
+				successCode:     http.StatusOK,
+				successRespBody: json.RawMessage(body),
+				successRatio:    1.0,
+				rateLimit:       1000,
+			},
+			reqCounter: 1,
+			logger:     newStructuredLogger(slog.LevelDebug),
+		}
+		api.makeRouter()
+		return api
+	}
+
+	tests := []struct {
+		name     string
+		apis     []*service
+		host     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "single API",
+			apis:     []*service{newAPI("", "/v1/mock", `{"api":"users"}`)},
+			host:     "example.com",
+			path:     "/v1/mock/",
+			wantCode: http.StatusOK,
+			wantBody: `{"api":"users"}`,
+		},
+		{
+			name:     "API selected by host",
+			apis:     []*service{newAPI("users.test", "/v1/mock", `{"api":"users"}`), newAPI("orders.test", "/v1/mock", `{"api":"orders"}`)},
+			host:     "Orders.test:8080",
+			path:     "/v1/mock/",
+			wantCode: http.StatusOK,
+			wantBody: `{"api":"orders"}`,
+		},
+		{
+			name:     "fallback API",
+			apis:     []*service{newAPI("users.test", "/v1/mock", `{"api":"users"}`), newAPI("", "/orders", `{"api":"orders"}`)},
+			host:     "example.com",
+			path:     "/orders/",
+			wantCode: http.StatusOK,
+			wantBody: `{"api":"orders"}`,
+		},
+		{
+			name:     "unknown host",
+			apis:     []*service{newAPI("users.test", "/v1/mock", `{"api":"users"}`)},
+			host:     "example.com",
+			path:     "/v1/mock/",
+			wantCode: http.StatusMisdirectedRequest,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			req.Host = test.host
+			w := httptest.NewRecorder()
+			newHostRouter(test.apis).ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d", test.wantCode, w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); test.wantBody != "" && got != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// jobTTL is the time jobs are kept after being submitted
+const jobTTL = time.Hour
+
+// Job statuses
+const (
+	jobPending   = "pending"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// routeParamRegex matches the parameters of a route pattern (e.g. "{id}" or "{id:[0-9]+}")
+var routeParamRegex = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// asyncJob is the definition of a route submitting asynchronous jobs, replied with 202 Accepted
+// and a status resource reporting the job as pending until it succeeds or fails
+type asyncJob struct {
+	Duration   int             `json:"duration"`   // time the job is pending (in milliseconds)
+	Polls      int             `json:"polls"`      // number of polls the job is pending
+	StatusPath string          `json:"statusPath"` // pattern of the status resource, capturing the job id as {jobId}
+	Result     json.RawMessage `json:"result"`     // result of succeeded jobs (any JSON value)
+	Error      json.RawMessage `json:"error"`      // error of failed jobs (any JSON value)
+	result     []byte          // result template
+	error      []byte          // error template
+}
+
+// job is a submitted asynchronous job
+type job struct {
+	ID          string          `json:"id"`
+	Status      string          `json:"status"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       json.RawMessage `json:"error,omitempty"`
+	def         *asyncJob       // job definition
+	polls       int             // number of polls so far
+	outcome     json.RawMessage // rendered result or error, revealed once completed
+	failed      bool            // whether the job fails
+}
+
+// validate checks the job definition and sets its defaults
+func (aj *asyncJob) validate(path string) error {
+	if aj.Duration < 0 || aj.Polls < 0 {
+		return errors.New("duration and polls can't be negative")
+	}
+
+	if aj.StatusPath == "" {
+		if strings.HasSuffix(path, "*") {
+			return errors.New("statusPath is required for paths ending with a wildcard")
+		}
+		aj.StatusPath = strings.TrimSuffix(path, "/") + "/{jobId}"
+	}
+	if err := validateRoutePattern(aj.StatusPath); err != nil {
+		return fmt.Errorf("invalid statusPath: %w", err)
+	}
+	if !stringSliceContains(patternParams(aj.StatusPath), "jobId") {
+		return errors.New("statusPath must capture the job id as {jobId}")
+	}
+	for _, param := range patternParams(aj.StatusPath) {
+		if param != "jobId" && !stringSliceContains(patternParams(path), param) {
+			return fmt.Errorf("statusPath parameter %s isn't captured by the route path", param)
+		}
+	}
+
+	var err error
+	if aj.result, err = parseJSONTemplate(aj.Result); err != nil {
+		return fmt.Errorf("invalid result: %w", err)
+	}
+	if aj.error, err = parseJSONTemplate(aj.Error); err != nil {
+		return fmt.Errorf("invalid error: %w", err)
+	}
+
+	return nil
+}
+
+// patternParams returns the names of the parameters captured by a route pattern
+func patternParams(pattern string) []string {
+	var params []string
+	for _, match := range routeParamRegex.FindAllStringSubmatch(pattern, -1) {
+		params = append(params, match[1])
+	}
+
+	return params
+}
+
+// handleJobSubmission mocks the submission of an asynchronous job, replying with 202 Accepted
+// and the location of its status resource. Whether the job succeeds or fails is decided on
+// submission based on the success ratio, and its result or error is rendered with the data
+// of the submission request.
+func (svc *service) handleJobSubmission(w http.ResponseWriter, r *http.Request, aj *asyncJob) {
+	j := &job{
+		ID:        strconv.FormatUint(rand.Uint64(), 16),
+		Status:    jobPending,
+		CreatedAt: time.Now().UTC(),
+		def:       aj,
+		failed:    shouldFail(svc.cfg.successRatio, svc.reqCounter),
+	}
+
+	var err error
+	switch {
+	case j.failed && aj.error != nil:
+		j.outcome, err = svc.renderJSONBody(r, aj.error)
+	case j.failed:
+		logID := svc.LogRequestFailure(r, "[handleJobSubmission] failed job "+j.ID, nil)
+		j.outcome, err = json.Marshal(api.MakeHTTPErrorResponse("failed job", api.CodeFailedRequest, logID).Error)
+	case aj.result != nil:
+		j.outcome, err = svc.renderJSONBody(r, aj.result)
+	}
+	if err != nil {
+		svc.renderTemplateError(w, r, err)
+		return
+	}
+
+	svc.storeJob(j)
+
+	params := pathParams(r)
+	params["jobId"] = j.ID
+	location := svc.cfg.uriPrefix + routeParamRegex.ReplaceAllStringFunc(aj.StatusPath, func(param string) string {
+		return params[routeParamRegex.FindStringSubmatch(param)[1]]
+	})
+	w.Header().Set("Location", location)
+	setRetryAfter(w, j)
+	renderJSON(w, r, http.StatusAccepted, j)
+}
+
+// handleJobStatus mocks the status resource of the asynchronous jobs
+// Route: /v1/mock/<job status path>
+func (svc *service) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	j := svc.jobs[chi.URLParam(r, "jobId")]
+	if j == nil {
+		logID := svc.LogRequestFailure(r, "[handleJobStatus] job not found: "+chi.URLParam(r, "jobId"), nil)
+		renderJSON(w, r, http.StatusNotFound, api.MakeHTTPErrorResponse("job not found", api.CodeNotFound, logID))
+		return
+	}
+
+	j.poll()
+	if j.Status == jobPending {
+		setRetryAfter(w, j)
+	}
+	renderJSON(w, r, http.StatusOK, j)
+}
+
+// storeJob stores a submitted job, discarding the expired ones
+func (svc *service) storeJob(j *job) {
+	if svc.jobs == nil {
+		svc.jobs = map[string]*job{}
+	}
+	for id, stored := range svc.jobs {
+		if time.Since(stored.CreatedAt) > jobTTL {
+			delete(svc.jobs, id)
+		}
+	}
+	svc.jobs[j.ID] = j
+}
+
+// poll counts a poll of the job status, completing the job once
+// it has been pending for the configured duration and polls
+func (j *job) poll() {
+	if j.Status != jobPending {
+		return
+	}
+
+	j.polls++
+	if j.polls <= j.def.Polls || time.Since(j.CreatedAt) < time.Duration(j.def.Duration)*time.Millisecond {
+		return
+	}
+
+	completedAt := time.Now().UTC()
+	j.CompletedAt = &completedAt
+	if j.failed {
+		j.Status, j.Error = jobFailed, j.outcome
+	} else {
+		j.Status, j.Result = jobSucceeded, j.outcome
+	}
+}
+
+// setRetryAfter sets the Retry-After header with the seconds left until the job may complete (1 at least)
+func setRetryAfter(w http.ResponseWriter, j *job) {
+	left := time.Until(j.CreatedAt.Add(time.Duration(j.def.Duration) * time.Millisecond))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(left.Seconds())))))
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_service_asyncJobs(t *testing.T) {
+	tests := []struct {
+		name         string
+		job          asyncJob
+		ratio        float64
+		wantLocation string
+		wantStatuses []string
+		wantBody     string
+	}{
+		{
+			name:         "job pending for a number of polls",
+			job:          asyncJob{Polls: 2, Result: json.RawMessage(`{"url": "/files/{{.Params.id}}.csv"}`)},
+			wantLocation: "/v1/mock/reports/42/exports/",
+			wantStatuses: []string{jobPending, jobPending, jobSucceeded, jobSucceeded},
+			wantBody:     `"result":{"url":"/files/42.csv"}`,
+		},
+		{
+			name:         "job pending for a duration",
+			job:          asyncJob{Duration: 50, StatusPath: "/jobs/{jobId}"},
+			wantLocation: "/v1/mock/jobs/",
+			wantStatuses: []string{jobPending, "wait", jobSucceeded},
+		},
+		{
+			name:         "failed job",
+			job:          asyncJob{Error: json.RawMessage(`{"reason": "quota exceeded"}`)},
+			ratio:        0.5,
+			wantLocation: "/v1/mock/reports/42/exports/",
+			wantStatuses: []string{jobFailed},
+			wantBody:     `"error":{"reason":"quota exceeded"}`,
+		},
+		{
+			name:         "failed job with the default error",
+			job:          asyncJob{},
+			ratio:        0.5,
+			wantLocation: "/v1/mock/reports/42/exports/",
+			wantStatuses: []string{jobFailed},
+			wantBody:     `"error":{"message":"failed job","code":1005,`,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{Path: "/reports/{id}/exports", Job: &test.job}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			ratio := 1.0
+			if test.ratio != 0 {
+				ratio = test.ratio
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					successRatio: ratio,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/mock/reports/42/exports", nil))
+			if w.Code != http.StatusAccepted {
+				tt.Fatalf("expected status code %d, got %d (%s)", http.StatusAccepted, w.Code, w.Body.String())
+			}
+			location := w.Header().Get("Location")
+			if !strings.HasPrefix(location, test.wantLocation) {
+				tt.Fatalf("expected location with prefix %s, got %s", test.wantLocation, location)
+			}
+			if w.Header().Get("Retry-After") == "" {
+				tt.Errorf("expected Retry-After header")
+			}
+			if !strings.Contains(w.Body.String(), `"status":"pending"`) {
+				tt.Errorf("expected pending job, got %s", w.Body.String())
+			}
+
+			var body string
+			for _, wantStatus := range test.wantStatuses {
+				if wantStatus == "wait" {
+					time.Sleep(time.Duration(test.job.Duration) * time.Millisecond)
+					continue
+				}
+				w = httptest.NewRecorder()
+				svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+				if w.Code != http.StatusOK {
+					tt.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, w.Code, w.Body.String())
+				}
+				body = w.Body.String()
+				if !strings.Contains(body, `"status":"`+wantStatus+`"`) {
+					tt.Errorf("expected %s job, got %s", wantStatus, body)
+				}
+			}
+			if !strings.Contains(body, test.wantBody) {
+				tt.Errorf("expected body containing %s, got %s", test.wantBody, body)
+			}
+		})
+	}
+}
+
+func Test_service_handleJobStatus_notFound(t *testing.T) {
+	t.Parallel()
+	rt := route{Path: "/exports", Job: &asyncJob{}}
+	if err := rt.validate(); err != nil {
+		t.Fatalf("invalid route: %v", err)
+	}
+	svc := &service{
+		cfg: &config{
+			uriPrefix:    "/v1/mock",
+			successRatio: 1,
+			rateLimit:    1000,
+			routes:       []route{rt},
+		},
+		reqCounter: 1,
+		logger:     newStructuredLogger(slog.LevelDebug),
+	}
+	svc.makeRouter()
+
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/mock/exports/foo", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
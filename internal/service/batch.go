@@ -0,0 +1,389 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// batchPath is the route of batch requests, served under URI_PREFIX, which can't be mocked
+const batchPath = "/batch"
+
+// batchRequestKey is the context key marking the requests dispatched by batch requests
+type batchRequestKey struct{}
+
+// isBatchRequest returns true if the request was dispatched by a batch request
+func isBatchRequest(r *http.Request) bool {
+	return r.Context().Value(batchRequestKey{}) != nil
+}
+
+// batchItem is a request of a batch request
+type batchItem struct {
+	method    string      // request method
+	target    string      // request path (including the URI prefix) and query string
+	header    http.Header // request headers
+	body      []byte      // request body
+	contentID string      // Content-ID of the multipart/mixed part holding the request (if any)
+	err       error       // parsing error, replied as a bad request
+}
+
+// handleBatchMock mocks batch request handling, dispatching every request of the batch
+// through the router so they're replied as if they were sent on their own. Batches can be
+// sent as a JSON array (either as the body or as the "batch" form field) or as a
+// multipart/mixed body of application/http parts, which is replied in the same format.
+// Up to BATCH_PARALLELISM requests of the batch (all of them by default) are dispatched concurrently.
+// Route: /v1/mock/batch
+func (svc *service) handleBatchMock(w http.ResponseWriter, r *http.Request) {
+	if isBatchRequest(r) {
+		logID := svc.LogRequestFailure(r, "[handleBatchMock] nested batch request", nil)
+		renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("nested batch requests aren't supported", api.CodeInvalidBody, logID))
+		return
+	}
+
+	// the body is limited before being read, as BATCH_MAX_SIZE can only be checked once parsed
+	body, err := readBody(w, r, int64(max(svc.cfg.batchMaxSize, 1))*maxBodySize)
+	if err != nil {
+		svc.renderBodyReadingError(w, r, "handleBatchMock", err)
+		return
+	}
+
+	var items []batchItem
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isMultipart := mediaType == "multipart/mixed"
+	switch {
+	case isMultipart:
+		items, err = svc.parseMultipartBatch(body, params["boundary"])
+	case isJSONMediaType(mediaType) || bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")):
+		items, err = svc.parseJSONBatch(body)
+	default:
+		var form url.Values
+		if form, err = url.ParseQuery(string(body)); err == nil {
+			items, err = svc.parseJSONBatch([]byte(form.Get("batch")))
+		}
+	}
+	if err != nil {
+		logID := svc.LogRequestFailure(r, fmt.Sprintf("[handleBatchMock] body reading error: %+v", err), err)
+		renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("body parsing error", api.CodeInvalidBody, logID))
+		return
+	}
+	if svc.cfg.batchMaxSize > 0 && len(items) > svc.cfg.batchMaxSize {
+		logID := svc.LogRequestFailure(r, fmt.Sprintf("[handleBatchMock] batch of %d requests", len(items)), nil)
+		renderJSON(w, r, http.StatusRequestEntityTooLarge, api.MakeHTTPErrorResponse(fmt.Sprintf("batch size exceeds the limit of %d requests", svc.cfg.batchMaxSize), api.CodeBatchTooLarge, logID))
+		return
+	}
+
+	// the batch request is counted, while its requests are counted as they're dispatched
+	svc.mu.Lock()
+	svc.reqCounter++
+	svc.mu.Unlock()
+
+	responses := make([]*batchResponseWriter, len(items))
+	slots := make(chan struct{}, max(svc.cfg.batchParallelism, 1))
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			responses[i] = svc.dispatchBatchItem(r, &items[i])
+		}()
+	}
+	wg.Wait()
+
+	if isMultipart {
+		writeMultipartBatch(w, items, responses)
+		return
+	}
+	batchResponses := make([]api.BatchResponse, 0, len(responses))
+	for _, rw := range responses {
+		batchResponses = append(batchResponses, rw.response())
+	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, batchResponses)
+}
+
+// parseJSONBatch parses a JSON array of batch requests
+func (svc *service) parseJSONBatch(data []byte) ([]batchItem, error) {
+	var requests []api.BatchRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return nil, err
+	}
+
+	items := make([]batchItem, 0, len(requests))
+	for i := range requests {
+		items = append(items, svc.newJSONBatchItem(&requests[i]))
+	}
+
+	return items, nil
+}
+
+// newJSONBatchItem returns the batch item of a request of a JSON batch
+func (svc *service) newJSONBatchItem(single *api.BatchRequest) batchItem {
+	item := batchItem{method: single.Method, header: http.Header{}}
+	if single.RelativeURL == "" {
+		item.err = errors.New("relative_url is required")
+		return item
+	}
+	relativeURL, err := url.Parse(single.RelativeURL)
+	if err != nil || relativeURL.Scheme != "" || relativeURL.Host != "" {
+		item.err = fmt.Errorf("invalid relative_url %q", single.RelativeURL)
+		return item
+	}
+	item.target = (&url.URL{
+		Path:     svc.cfg.uriPrefix + "/" + strings.TrimPrefix(relativeURL.Path, "/"),
+		RawQuery: relativeURL.RawQuery,
+	}).String()
+
+	var text string
+	switch {
+	case len(single.Body) == 0 || string(single.Body) == "null":
+	case json.Unmarshal(single.Body, &text) == nil:
+		item.body = []byte(text)
+	default:
+		item.body = single.Body
+		item.header.Set("Content-Type", "application/json")
+	}
+	overridden := map[string]bool{}
+	for _, h := range single.Headers {
+		if !overridden[http.CanonicalHeaderKey(h.Name)] {
+			item.header.Del(h.Name)
+			overridden[http.CanonicalHeaderKey(h.Name)] = true
+		}
+		item.header.Add(h.Name, h.Value)
+	}
+
+	return item
+}
+
+// parseMultipartBatch parses a multipart/mixed batch, whose parts hold HTTP requests (application/http)
+func (svc *service) parseMultipartBatch(data []byte, boundary string) ([]batchItem, error) {
+	if boundary == "" {
+		return nil, errors.New("missing multipart boundary")
+	}
+
+	var items []batchItem
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		item := batchItem{contentID: part.Header.Get("Content-ID")}
+		if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); mediaType != "application/http" {
+			item.err = fmt.Errorf("invalid part content type %q", part.Header.Get("Content-Type"))
+		} else {
+			item.method, item.target, item.header, item.body, item.err = readHTTPRequest(part)
+		}
+		if item.err == nil && !strings.HasPrefix(item.target, "/") {
+			// request paths not starting with a slash are relative to the URI prefix
+			item.target = svc.cfg.uriPrefix + "/" + item.target
+		}
+		items = append(items, item)
+	}
+}
+
+// readHTTPRequest reads a HTTP request (as sent in the application/http parts of multipart batches),
+// whose request line may omit the HTTP version and whose target may be an absolute URL
+func readHTTPRequest(r io.Reader) (method, target string, header http.Header, body []byte, err error) {
+	tp := textproto.NewReader(bufio.NewReader(r))
+	line := ""
+	for line == "" {
+		if line, err = tp.ReadLine(); err != nil {
+			return "", "", nil, nil, fmt.Errorf("invalid request line: %w", err)
+		}
+		line = strings.TrimSpace(line)
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", "", nil, nil, fmt.Errorf("invalid request line %q", line)
+	}
+	method, target = fields[0], fields[1]
+	if u, err := url.Parse(target); err != nil {
+		return "", "", nil, nil, fmt.Errorf("invalid request target %q", target)
+	} else if u.IsAbs() {
+		target = u.RequestURI()
+	}
+
+	mimeHeader, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return "", "", nil, nil, fmt.Errorf("invalid request headers: %w", err)
+	}
+	if body, err = io.ReadAll(tp.R); err != nil {
+		return "", "", nil, nil, err
+	}
+	header = http.Header(mimeHeader)
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length >= 0 && length < len(body) {
+		body = body[:length]
+	} else {
+		body = bytes.TrimRight(body, "\r\n")
+	}
+
+	return method, target, header, body, nil
+}
+
+// dispatchBatchItem dispatches a request of a batch request through the router, returning its response
+// (reporting its duration in the Server-Timing header if batch timing is enabled)
+func (svc *service) dispatchBatchItem(r *http.Request, item *batchItem) *batchResponseWriter {
+	start := time.Now()
+	rw := &batchResponseWriter{header: http.Header{}}
+	req, err := svc.newBatchSubRequest(r, item)
+	if err != nil {
+		logID := svc.LogRequestFailure(r, fmt.Sprintf("[dispatchBatchItem] invalid request: %+v", err), err)
+		// written with an explicit status, as render.Status would modify the batch request
+		// shared by the requests dispatched concurrently
+		rw.header.Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(rw).Encode(api.MakeHTTPErrorResponse("invalid batch request: "+err.Error(), api.CodeInvalidBody, logID))
+	} else {
+		svc.router.ServeHTTP(rw, req)
+	}
+
+	if svc.cfg.batchTiming {
+		rw.header.Add("Server-Timing", fmt.Sprintf("total;dur=%.3f", float64(time.Since(start).Microseconds())/1000))
+	}
+
+	return rw
+}
+
+// newBatchSubRequest returns the HTTP request of a request of a batch request, inheriting the
+// headers (e.g. credentials), client address and TLS state of the batch request
+func (svc *service) newBatchSubRequest(r *http.Request, item *batchItem) (*http.Request, error) {
+	if item.err != nil {
+		return nil, item.err
+	}
+	method := item.method
+	if method == "" {
+		method = http.MethodGet
+	}
+	method, err := parseMethod(method)
+	if err != nil {
+		return nil, err
+	}
+
+	// the routing context of the batch request is reset, so the request is routed from scratch
+	ctx := context.WithValue(context.WithValue(r.Context(), chi.RouteCtxKey, nil), batchRequestKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, method, item.target, bytes.NewReader(item.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Type")
+	for name, values := range item.header {
+		req.Header[name] = values
+	}
+	req.Host = r.Host
+	req.RemoteAddr = r.RemoteAddr
+	req.TLS = r.TLS
+
+	return req, nil
+}
+
+// writeMultipartBatch writes the responses of a multipart/mixed batch as application/http parts,
+// identified by the Content-ID of their requests prefixed with "response-"
+func writeMultipartBatch(w http.ResponseWriter, items []batchItem, responses []*batchResponseWriter) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+
+	for i, rw := range responses {
+		partHeader := textproto.MIMEHeader{"Content-Type": {"application/http"}}
+		if contentID := items[i].contentID; contentID != "" {
+			// set as is, since the Content-ID spelling isn't canonical
+			partHeader["Content-ID"] = []string{"<response-" + strings.TrimSuffix(strings.TrimPrefix(contentID, "<"), ">") + ">"}
+		}
+		part, err := mw.CreatePart(partHeader)
+		if err != nil {
+			return
+		}
+		code := rw.statusCode()
+		_, _ = fmt.Fprintf(part, "HTTP/1.1 %d %s\r\n", code, http.StatusText(code))
+		_ = rw.header.Write(part)
+		_, _ = io.WriteString(part, "\r\n")
+		_, _ = part.Write(rw.body.Bytes())
+	}
+	_ = mw.Close()
+}
+
+// batchResponseWriter is a http.ResponseWriter recording the response to a request of a batch request
+type batchResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+// Header implements the http.ResponseWriter interface
+func (rw *batchResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+// WriteHeader implements the http.ResponseWriter interface
+func (rw *batchResponseWriter) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+}
+
+// Write implements the http.ResponseWriter interface
+func (rw *batchResponseWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	return rw.body.Write(b)
+}
+
+// statusCode returns the recorded status code (200 if none was written)
+func (rw *batchResponseWriter) statusCode() int {
+	if rw.code == 0 {
+		return http.StatusOK
+	}
+
+	return rw.code
+}
+
+// response returns the recorded response, with its headers sorted by name and its body compacted if it's JSON
+func (rw *batchResponseWriter) response() api.BatchResponse {
+	resp := api.BatchResponse{Code: rw.statusCode(), Headers: []api.Header{}}
+
+	names := make([]string, 0, len(rw.header))
+	for name := range rw.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range rw.header[name] {
+			resp.Headers = append(resp.Headers, api.Header{Name: name, Value: value})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if json.Compact(buf, rw.body.Bytes()) == nil {
+		resp.Body = buf.String()
+	} else {
+		resp.Body = rw.body.String()
+	}
+
+	return resp
+}
@@ -0,0 +1,480 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+func Test_service_handleBatchMock(t *testing.T) {
+	tests := []struct {
+		name         string
+		svc          *service
+		setupRequest func() *http.Request
+		respHandler  func(tt *testing.T, resp *httptest.ResponseRecorder)
+	}{
+		{
+			name: "success batch request with custom response body",
+			svc: &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					failureCode:     http.StatusBadRequest,
+					successRespBody: json.RawMessage(`{"success": true}`),
+					successCode:     http.StatusOK,
+					successRatio:    0.5,
+					rateLimit:       1000,
+					methods:         []string{http.MethodGet},
+					subRoutes:       []string{"/foo"},
+				},
+				logger: newStructuredLogger(slog.LevelDebug),
+			},
+			setupRequest: func() *http.Request {
+				reqBody := `[{
+					"method": "GET",
+					"relative_url": "/foo",
+					"body": null
+				}, {
+					"method": "GET",
+					"relative_url": "foo?page=2"
+				}, {
+					"method": "GET",
+					"relative_url": "/bar"
+				}]`
+				encodedBody := url.Values{}
+				encodedBody.Set("batch", reqBody)
+
+				req := httptest.NewRequest(
+					http.MethodPost,
+					"/v1/mock/batch",
+					strings.NewReader(encodedBody.Encode()),
+				)
+				return req
+			},
+			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
+				if resp.Code != http.StatusOK {
+					tt.Errorf("expected status code %d, got %d", http.StatusOK, resp.Code)
+				}
+				if resp.Header().Get("Content-Type") != "application/json" {
+					tt.Errorf("expected content type %s, got %s", "application/json", resp.Header().Get("Content-Type"))
+				}
+				var batchResponse []api.BatchResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
+					tt.Errorf("could not unmarshal response body: %+v", err)
+				}
+
+				if len(batchResponse) != 3 {
+					tt.Fatalf("expected batch response length %d, got %d", 3, len(batchResponse))
+				}
+
+				if batchResponse[0].Code != 200 || batchResponse[0].Body != "{\"success\":true}" {
+					tt.Errorf("expected response code %d and body %s, got %d and %s", 200, "{\"success\":true}", batchResponse[0].Code, batchResponse[0].Body)
+				}
+				wantHeader := api.Header{Name: "Content-Type", Value: "application/json"}
+				if len(batchResponse[0].Headers) == 0 || batchResponse[0].Headers[0] != wantHeader {
+					tt.Errorf("expected header %v, got %v", wantHeader, batchResponse[0].Headers)
+				}
+
+				if batchResponse[1].Code != 400 {
+					tt.Errorf("expected response code %d, got %d", 400, batchResponse[1].Code)
+				}
+
+				var errorResponse api.HTTPErrorResponse
+				if err := json.Unmarshal([]byte(batchResponse[1].Body), &errorResponse); err != nil {
+					tt.Errorf("could not unmarshal response body: %+v", err)
+				}
+
+				if errorResponse.Error.Message != "failed request" || errorResponse.Error.Code != api.CodeFailedRequest {
+					tt.Errorf("expected error message %s and code %d, got %s and %d", "failed request", api.CodeFailedRequest, errorResponse.Error.Message, errorResponse.Error.Code)
+				}
+
+				if batchResponse[2].Code != 404 {
+					tt.Errorf("expected response code %d, got %d", 404, batchResponse[2].Code)
+				}
+			},
+		},
+		{
+			name: "success batch request with custom failure response body",
+			svc: &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					failureRespBody: json.RawMessage(`{"success": false}`),
+					failureCode:     http.StatusBadRequest,
+					successRespBody: json.RawMessage(`{"success": true}`),
+					successCode:     http.StatusOK,
+					successRatio:    0.5,
+					rateLimit:       1000,
+					methods:         []string{http.MethodGet},
+					subRoutes:       []string{"/foo"},
+				},
+				logger: newStructuredLogger(slog.LevelDebug),
+			},
+			setupRequest: func() *http.Request {
+				reqBody := `[{
+					"method": "GET",
+					"relative_url": "/foo",
+					"body": null
+				}, {
+					"method": "GET",
+					"relative_url": "/foo",
+					"body": null
+				}]`
+				encodedBody := url.Values{}
+				encodedBody.Set("batch", reqBody)
+
+				req := httptest.NewRequest(
+					http.MethodPost,
+					"/v1/mock/batch",
+					strings.NewReader(encodedBody.Encode()),
+				)
+				return req
+			},
+			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
+				if resp.Code != http.StatusOK {
+					tt.Errorf("expected status code %d, got %d", http.StatusOK, resp.Code)
+				}
+				if resp.Header().Get("Content-Type") != "application/json" {
+					tt.Errorf("expected content type %s, got %s", "application/json", resp.Header().Get("Content-Type"))
+				}
+				var batchResponse []api.BatchResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
+					tt.Errorf("could not unmarshal response body: %+v", err)
+				}
+
+				if batchResponse[0].Code != 200 || batchResponse[0].Body != "{\"success\":true}" {
+					tt.Errorf("expected response code %d and body %s, got %d and %s", 200, "{\"success\":true}", batchResponse[0].Code, batchResponse[0].Body)
+				}
+
+				if batchResponse[1].Code != 400 || batchResponse[1].Body != "{\"success\":false}" {
+					tt.Errorf("expected response code %d and body %s, got %d and %s", 400, "{\"success\":false}", batchResponse[1].Code, batchResponse[1].Body)
+				}
+			},
+		},
+		{
+			name: "success batch request with array response body",
+			svc: &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					failureCode:     http.StatusBadRequest,
+					successRespBody: json.RawMessage(`[{"id": 1}, {"id": 2}]`),
+					successCode:     http.StatusOK,
+					successRatio:    1.0,
+					rateLimit:       1000,
+					methods:         []string{http.MethodGet},
+					subRoutes:       []string{"/foo"},
+				},
+				logger: newStructuredLogger(slog.LevelDebug),
+			},
+			setupRequest: func() *http.Request {
+				reqBody := `[{
+					"method": "GET",
+					"relative_url": "/foo",
+					"body": null
+				}]`
+				encodedBody := url.Values{}
+				encodedBody.Set("batch", reqBody)
+
+				req := httptest.NewRequest(
+					http.MethodPost,
+					"/v1/mock/batch",
+					strings.NewReader(encodedBody.Encode()),
+				)
+				return req
+			},
+			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
+				if resp.Code != http.StatusOK {
+					tt.Errorf("expected status code %d, got %d", http.StatusOK, resp.Code)
+				}
+				var batchResponse []api.BatchResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
+					tt.Errorf("could not unmarshal response body: %+v", err)
+				}
+
+				if len(batchResponse) != 1 || batchResponse[0].Code != 200 || batchResponse[0].Body != `[{"id":1},{"id":2}]` {
+					tt.Errorf("expected a single response with code %d and body %s, got %v", 200, `[{"id":1},{"id":2}]`, batchResponse)
+				}
+			},
+		},
+		{
+			name: "batch request dispatched to routes",
+			svc: &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					successRespBody: json.RawMessage(`{"success": true}`),
+					successCode:     http.StatusOK,
+					successRatio:    1.0,
+					rateLimit:       1000,
+					methods:         []string{http.MethodGet},
+					routes: []route{
+						{
+							Path:    "/users/{id}",
+							Methods: []string{http.MethodPut},
+							Representations: []representation{{
+								ContentType: "application/json",
+								payload:     []byte(`{"id": "{{.Params.id}}", "tenant": "{{.Headers.Get "X-Tenant"}}", "type": "{{.Headers.Get "Content-Type"}}"}`),
+							}},
+						},
+						{Path: "/events", Methods: []string{http.MethodGet}, SSE: &sse{}},
+					},
+				},
+				logger: newStructuredLogger(slog.LevelDebug),
+			},
+			setupRequest: func() *http.Request {
+				reqBody := `[{
+					"method": "PUT",
+					"relative_url": "users/42",
+					"headers": [{"name": "Content-Type", "value": "application/json"}],
+					"body": {"name": "Jane"}
+				}, {
+					"relative_url": "/events"
+				}, {
+					"method": "GET",
+					"relative_url": "/batch"
+				}, {
+					"method": "GET"
+				}]`
+				encodedBody := url.Values{}
+				encodedBody.Set("batch", reqBody)
+
+				req := httptest.NewRequest(
+					http.MethodPost,
+					"/v1/mock/batch",
+					strings.NewReader(encodedBody.Encode()),
+				)
+				req.Header.Set("X-Tenant", "acme")
+				return req
+			},
+			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
+				var batchResponse []api.BatchResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
+					tt.Fatalf("could not unmarshal response body: %+v", err)
+				}
+				if len(batchResponse) != 4 {
+					tt.Fatalf("expected batch response length %d, got %d", 4, len(batchResponse))
+				}
+
+				want := `{"id":"42","tenant":"acme","type":"application/json"}`
+				if batchResponse[0].Code != 200 || batchResponse[0].Body != want {
+					tt.Errorf("expected response code %d and body %s, got %d and %s", 200, want, batchResponse[0].Code, batchResponse[0].Body)
+				}
+				for i, code := range []int{http.StatusBadRequest, http.StatusNotFound, http.StatusBadRequest} {
+					if batchResponse[i+1].Code != code {
+						tt.Errorf("expected response %d code %d, got %d (%s)", i+1, code, batchResponse[i+1].Code, batchResponse[i+1].Body)
+					}
+				}
+			},
+		},
+		{
+			name: "batch request body larger than its limit",
+			svc: &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					successRespBody: json.RawMessage(`{"success": true}`),
+					successCode:     http.StatusOK,
+					successRatio:    1.0,
+					rateLimit:       1000,
+					batchMaxSize:    1,
+					methods:         []string{http.MethodPost},
+					subRoutes:       []string{"/foo"},
+				},
+				logger: newStructuredLogger(slog.LevelDebug),
+			},
+			setupRequest: func() *http.Request {
+				reqBody := `[{"method": "POST", "relative_url": "/foo", "body": "` + strings.Repeat("x", int(maxBodySize)) + `"}]`
+				req := httptest.NewRequest(http.MethodPost, "/v1/mock/batch", strings.NewReader(reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
+				if resp.Code != http.StatusRequestEntityTooLarge {
+					tt.Errorf("expected status code %d, got %d (%s)", http.StatusRequestEntityTooLarge, resp.Code, resp.Body.String())
+				}
+			},
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			resp := httptest.NewRecorder()
+			test.svc.reqCounter = 1
+			test.svc.makeRouter()
+			test.svc.router.ServeHTTP(resp, test.setupRequest())
+			test.respHandler(tt, resp)
+		})
+	}
+}
+
+func Test_service_handleBatchMock_parallelism(t *testing.T) {
+	delay := 200
+	tests := []struct {
+		name        string
+		parallelism int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "sequential batch",
+			parallelism: 1,
+			minDuration: 3 * time.Duration(delay) * time.Millisecond,
+		},
+		{
+			name:        "concurrent batch",
+			parallelism: 3,
+			minDuration: time.Duration(delay) * time.Millisecond,
+			maxDuration: 2 * time.Duration(delay) * time.Millisecond,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			svc := &service{
+				cfg: &config{
+					uriPrefix:        "/v1/mock",
+					successRespBody:  json.RawMessage(`{"success": true}`),
+					successCode:      http.StatusOK,
+					successRatio:     1.0,
+					rateLimit:        1000,
+					batchParallelism: test.parallelism,
+					batchTiming:      true,
+					methods:          []string{http.MethodGet},
+					subRoutes:        []string{"/fast"},
+					routes:           []route{{Path: "/slow", Methods: []string{http.MethodGet}, Delay: &delay}},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			reqBody := `[{"relative_url": "/slow"}, {"relative_url": "/fast"}, {"relative_url": "/slow"}, {"relative_url": "/slow"}]`
+			req := httptest.NewRequest(http.MethodPost, "/v1/mock/batch", strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			start := time.Now()
+			svc.router.ServeHTTP(resp, req)
+			elapsed := time.Since(start)
+
+			if elapsed < test.minDuration || (test.maxDuration > 0 && elapsed > test.maxDuration) {
+				tt.Errorf("unexpected batch duration %s", elapsed)
+			}
+			var batchResponse []api.BatchResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
+				tt.Fatalf("could not unmarshal response body: %+v", err)
+			}
+			if len(batchResponse) != 4 {
+				tt.Fatalf("expected batch response length %d, got %d", 4, len(batchResponse))
+			}
+			for i, br := range batchResponse {
+				if br.Code != http.StatusOK {
+					tt.Errorf("expected response %d code %d, got %d", i, http.StatusOK, br.Code)
+				}
+				timing := ""
+				for _, h := range br.Headers {
+					if h.Name == "Server-Timing" {
+						timing = h.Value
+					}
+				}
+				var dur float64
+				if _, err := fmt.Sscanf(timing, "total;dur=%f", &dur); err != nil {
+					tt.Errorf("unexpected Server-Timing header of response %d: %q", i, timing)
+				}
+				if slow := i != 1; slow && dur < float64(delay) {
+					tt.Errorf("expected response %d to last at least %dms, got %.3fms", i, delay, dur)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_handleBatchMock_concurrentStatuses(t *testing.T) {
+	delay := 50
+	rt := route{
+		Path:    "/users/{id}",
+		Delay:   &delay,
+		Methods: []string{http.MethodGet},
+		Representations: []representation{{
+			ContentType: "application/json",
+			Body:        json.RawMessage(`{"id": "{{.Params.id}}"}`),
+		}},
+	}
+	adminRt := route{Path: "/admin", Claims: map[string]interface{}{"role": "admin"}}
+	for _, r := range []*route{&rt, &adminRt} {
+		if err := r.validate(); err != nil {
+			t.Fatalf("invalid route: %v", err)
+		}
+	}
+	svc := &service{
+		cfg: &config{
+			uriPrefix:        "/v1/mock",
+			successRespBody:  json.RawMessage(`{"success": true}`),
+			successCode:      http.StatusOK,
+			successRatio:     1.0,
+			rateLimit:        1000,
+			batchMaxSize:     50,
+			batchParallelism: 8,
+			methods:          []string{http.MethodGet},
+			subRoutes:        []string{"/ok"},
+			routes:           []route{rt, adminRt, {Path: "/events", Methods: []string{http.MethodGet}, SSE: &sse{}}},
+		},
+		reqCounter: 1,
+		logger:     newStructuredLogger(slog.LevelDebug),
+	}
+	svc.makeRouter()
+
+	// requests replied with different status codes, some of them by the batch handler itself
+	items := []struct {
+		request  string
+		wantCode int
+	}{
+		{`{"relative_url": "/users/1"}`, http.StatusOK},
+		{`{"relative_url": "/ok"}`, http.StatusOK},
+		{`{"relative_url": "/missing"}`, http.StatusNotFound},
+		{`{"relative_url": "/admin"}`, http.StatusForbidden},
+		{`{"relative_url": "/users/2", "headers": [{"name": "Accept", "value": "text/csv"}]}`, http.StatusNotAcceptable},
+		{`{"method": "G E T", "relative_url": "/ok"}`, http.StatusBadRequest},
+		{`{"relative_url": "/events"}`, http.StatusBadRequest},
+		{`{"relative_url": "/users/3"}`, http.StatusOK},
+	}
+	requests := make([]string, 0, len(items))
+	for _, item := range items {
+		requests = append(requests, item.request)
+	}
+	reqBody := "[" + strings.Join(requests, ",") + "]"
+
+	t.Parallel()
+	for i := 0; i < 5; i++ {
+		t.Run(fmt.Sprintf("batch %d", i), func(tt *testing.T) {
+			tt.Parallel()
+			req := httptest.NewRequest(http.MethodPost, "/v1/mock/batch", strings.NewReader(reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			svc.router.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK {
+				tt.Fatalf("expected status code %d, got %d (%s)", http.StatusOK, resp.Code, resp.Body.String())
+			}
+			var batchResponse []api.BatchResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
+				tt.Fatalf("could not unmarshal response body: %+v", err)
+			}
+			if len(batchResponse) != len(items) {
+				tt.Fatalf("expected batch response length %d, got %d", len(items), len(batchResponse))
+			}
+			for j, item := range items {
+				if batchResponse[j].Code != item.wantCode {
+					tt.Errorf("expected response %d code %d, got %d (%s)", j, item.wantCode, batchResponse[j].Code, batchResponse[j].Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/juan131/api-mock/pkg/api"
+	"github.com/juan131/api-mock/pkg/authn"
+)
+
+const insufficientScopeHeader string = `Bearer realm="example", error="insufficient_scope", error_description="insufficient token claims"`
+
+// requireClaims returns a handler rejecting the requests whose JWT doesn't hold the claims
+// required by the route (if any), as production APIs do with wrongly-scoped tokens
+func (svc *service) requireClaims(rt *route, next http.HandlerFunc) http.HandlerFunc {
+	if len(rt.Claims) == 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := authn.Claims(r)
+		for name, want := range rt.Claims {
+			if !claimMatches(claims[name], want) {
+				logID := svc.LogRequestFailure(r, fmt.Sprintf("[requireClaims] claim %s doesn't match %v", name, want), nil)
+				w.Header().Set("WWW-Authenticate", insufficientScopeHeader)
+				renderJSON(w, r, http.StatusForbidden, api.MakeHTTPErrorResponse("insufficient token claims", api.CodeForbidden, logID))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// claimMatches returns true if a claim holds the required value. Claims holding arrays or
+// space-separated strings (e.g. scope) match if they hold the value (every value if it's an array).
+func claimMatches(claim, want interface{}) bool {
+	if wanted, ok := want.([]interface{}); ok {
+		for _, w := range wanted {
+			if !claimMatches(claim, w) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch c := claim.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, v := range c {
+			if claimMatches(v, want) {
+				return true
+			}
+		}
+		return false
+	case string:
+		if s, ok := want.(string); ok {
+			return c == s || stringSliceContains(strings.Fields(c), s)
+		}
+	}
+
+	// other values (e.g. numbers) are compared by their JSON encoding
+	got, _ := json.Marshal(claim)
+	expected, _ := json.Marshal(want)
+	return string(got) == string(expected)
+}
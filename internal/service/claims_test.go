@@ -0,0 +1,150 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juan131/api-mock/pkg/authn"
+)
+
+// signHS256 returns a JWT holding the given claims signed with the given secret (HS256)
+func signHS256(secret string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func Test_service_requireClaims(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name     string
+		setAuth  func(r *http.Request)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "token with the required claims",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signHS256("some-secret", map[string]interface{}{"sub": "alice", "scope": "orders:read orders:write", "tier": 2, "exp": exp}))
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"owner": "alice", "tier": 2}`,
+		},
+		{
+			name: "token without the required scope",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signHS256("some-secret", map[string]interface{}{"sub": "alice", "scope": "orders:write", "tier": 2, "exp": exp}))
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "token with another tier",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signHS256("some-secret", map[string]interface{}{"sub": "alice", "scope": "orders:read", "tier": 1, "exp": exp}))
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "expired token",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+signHS256("some-secret", map[string]interface{}{"sub": "alice", "scope": "orders:read", "tier": 2, "exp": time.Now().Add(-time.Minute).Unix()}))
+			},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "API key without claims",
+			setAuth: func(r *http.Request) {
+				r.Header.Set("X-API-KEY", "some-key")
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{
+				Path:   "/orders/{id}",
+				Claims: map[string]interface{}{"scope": "orders:read", "tier": float64(2)},
+				Representations: []representation{{
+					ContentType: "application/json",
+					Body:        json.RawMessage(`"{\"owner\": \"{{.Claims.sub}}\", \"tier\": {{.Claims.tier}}}"`),
+				}},
+			}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					apiKeys:      []string{"some-key"},
+					jwt:          &authn.JWTConfig{Secret: []byte("some-secret")},
+					successCode:  http.StatusOK,
+					successRatio: 1,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/mock/orders/42", nil)
+			test.setAuth(req)
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Fatalf("expected status code %d, got %d (%s)", test.wantCode, w.Code, w.Body.String())
+			}
+			if test.wantCode == http.StatusForbidden && !strings.Contains(w.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+				tt.Errorf("expected an insufficient scope challenge, got %q", w.Header().Get("WWW-Authenticate"))
+			}
+			if got := strings.TrimSpace(w.Body.String()); test.wantBody != "" && got != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_claimMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim interface{}
+		want  interface{}
+		match bool
+	}{
+		{"equal strings", "admin", "admin", true},
+		{"different strings", "user", "admin", false},
+		{"space-separated scopes", "read write", "write", true},
+		{"array claim", []interface{}{"api-mock", "other"}, "api-mock", true},
+		{"array requirement", "read write", []interface{}{"read", "write"}, true},
+		{"partially held array requirement", "read", []interface{}{"read", "write"}, false},
+		{"numbers", json.Number("2"), float64(2), true},
+		{"booleans", true, true, true},
+		{"missing claim", nil, "admin", false},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if got := claimMatches(test.claim, test.want); got != test.match {
+				tt.Errorf("claimMatches(%v, %v) = %v, want %v", test.claim, test.want, got, test.match)
+			}
+		})
+	}
+}
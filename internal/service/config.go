@@ -6,49 +6,105 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/juan131/api-mock/pkg/authn"
 )
 
 const (
 	defaultPort      int     = 8080
+	defaultURIPrefix string  = "/v1/mock"
 	defaultRateLimit int     = 1000
+	defaultBatchSize int     = 50
 	defaultRatio     float64 = 1.0
+	defaultTLSPort   int     = 8443
+	defaultTLSDir    string  = "certs"
+	defaultGRPCPort  int     = 9090
+
+	livenessPath  string = "/live"
+	readinessPath string = "/ready"
 )
 
+// maxRespDelay is the maximum response delay
+const maxRespDelay = 30 * time.Second
+
+// defaultTLSHosts are the hosts covered by auto-generated certificates unless configured
+var defaultTLSHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// healthPaths are the paths of the health check endpoints, outside URI_PREFIX
+var healthPaths = []string{livenessPath, readinessPath}
+
+// registerMethodMu guards the registration of custom HTTP methods in the router
+var registerMethodMu sync.Mutex
+
+// defaultSuccessRespBody is the response body returned by successful requests unless configured
+var defaultSuccessRespBody = json.RawMessage(`{"success":true}`)
+
 // config is the service configuration
 type config struct {
-	port                 int                    // server listening port
-	apiKey               string                 // api key
-	apiToken             string                 // api token
-	methods, subRoutes   []string               // supported sub-routes
-	respDelay            time.Duration          // response delay in milliseconds
-	failureCode          int                    // response code for failed requests
-	failureRespBody      map[string]interface{} // response body for failed requests
-	successCode          int                    // response code for successful requests
-	successRespBody      map[string]interface{} // response body for successful requests
-	successRatio         float64                // ratio of successful requests
-	rateLimit            int                    // rate limit (requests per second)
-	rateExceededRespBody map[string]interface{} // response body for rate exceeded requests
+	name                 string            // mock API name
+	host                 string            // host the mock API is served for (any if empty)
+	port                 int               // server listening port
+	uriPrefix            string            // URI prefix of the mocked routes
+	apiKeys              []string          // api keys
+	apiTokens            []string          // api tokens
+	basicAuthUsers       map[string]string // basic auth passwords by user
+	jwt                  *authn.JWTConfig  // JWT bearer tokens validation (nil if disabled)
+	methods, subRoutes   []string          // supported sub-routes
+	respDelay            time.Duration     // response delay in milliseconds
+	failureCode          int               // response code for failed requests
+	failureRespBody      json.RawMessage   // response body for failed requests (any JSON value)
+	successCode          int               // response code for successful requests
+	successRespBody      json.RawMessage   // response body for successful requests (any JSON value)
+	successRatio         float64           // ratio of successful requests
+	rateLimit            int               // rate limit (requests per second)
+	rateExceededRespBody json.RawMessage   // response body for rate exceeded requests (any JSON value)
+	batchMaxSize         int               // maximum number of requests of batch requests
+	batchParallelism     int               // number of requests of batch requests dispatched concurrently
+	batchTiming          bool              // whether to report the duration of the requests of batch requests
+	routes               []route           // routes defined in the routes file
+	fakeSeed             *int64            // seed for fake data generation (random if nil)
+	respBodyTemplates    bool              // whether the configured response bodies are templates
+	h2c                  bool              // whether to serve HTTP/2 over cleartext (prior knowledge) on the plain port
+	tlsPort              int               // TLS server listening port (0 if TLS is disabled)
+	tlsCertFile          string            // TLS certificate file
+	tlsKeyFile           string            // TLS private key file
+	tlsAutoCert          bool              // whether to auto-generate a self-signed certificate
+	tlsCertDir           string            // directory where auto-generated certificates are written
+	tlsHosts             []string          // hosts covered by auto-generated certificates
+	tlsClientCAFile      string            // CA bundle to verify client certificates against (mTLS)
+	tlsClientAuth        string            // client certificates policy (require or optional)
+	tlsClientIdentity    string            // client certificate field mapped to the client identity
+	grpcPort             int               // gRPC server listening port (0 if gRPC is disabled)
+	grpcServices         *grpcServices     // mocked gRPC services (nil if gRPC is disabled)
 }
 
 // loadConfigFromEnv loads the configuration from the environment.
+func loadConfigFromEnv() (*config, error) {
+	return loadConfig(os.Getenv)
+}
+
+// loadConfig loads the configuration from the variables returned by getenv.
 //
 //nolint:cyclop // many env variables to parse
-func loadConfigFromEnv() (*config, error) {
+func loadConfig(getenv func(string) string) (*config, error) {
 	var err error
-	cfg := config{
-		apiKey:   os.Getenv("API_KEY"),
-		apiToken: os.Getenv("API_TOKEN"),
-	}
+	var cfg config
 
-	if cfg.apiKey != "" && cfg.apiToken != "" {
-		return nil, errors.New("only one of API_KEY or API_TOKEN can be set")
+	if err = loadAuthConfig(&cfg, getenv); err != nil {
+		return nil, err
 	}
 
-	portENV := os.Getenv("PORT")
+	portENV := getenv("PORT")
 	if portENV != "" {
 		cfg.port, err = strconv.Atoi(portENV)
 		if err != nil {
@@ -58,7 +114,16 @@ func loadConfigFromEnv() (*config, error) {
 		cfg.port = defaultPort
 	}
 
-	respDelayENV := os.Getenv("RESP_DELAY")
+	cfg.uriPrefix = defaultURIPrefix
+	if uriPrefixEnv := getenv("URI_PREFIX"); uriPrefixEnv != "" {
+		if !strings.HasPrefix(uriPrefixEnv, "/") {
+			return nil, fmt.Errorf("URI_PREFIX must start with /")
+		}
+		// "/" serves the mocked routes at the root level
+		cfg.uriPrefix = strings.TrimSuffix(path.Clean(uriPrefixEnv), "/")
+	}
+
+	respDelayENV := getenv("RESP_DELAY")
 	if respDelayENV != "" {
 		respDelayINT, err := strconv.Atoi(respDelayENV)
 		if err != nil {
@@ -66,12 +131,12 @@ func loadConfigFromEnv() (*config, error) {
 		}
 
 		cfg.respDelay = time.Duration(respDelayINT) * time.Millisecond
-		if cfg.respDelay > 30*time.Second {
+		if cfg.respDelay > maxRespDelay {
 			return nil, fmt.Errorf("RESP_DELAY cannot be greater than 30 seconds")
 		}
 	}
 
-	failureCodeEnv := os.Getenv("FAILURE_RESP_CODE")
+	failureCodeEnv := getenv("FAILURE_RESP_CODE")
 	if failureCodeEnv != "" {
 		cfg.failureCode, err = strconv.Atoi(failureCodeEnv)
 		if err != nil {
@@ -81,14 +146,22 @@ func loadConfigFromEnv() (*config, error) {
 		cfg.failureCode = http.StatusBadRequest // default response code
 	}
 
-	failureRespBodyEnv := os.Getenv("FAILURE_RESP_BODY")
+	respBodyTemplatesEnv := getenv("RESP_BODY_TEMPLATES")
+	if respBodyTemplatesEnv != "" {
+		cfg.respBodyTemplates, err = strconv.ParseBool(respBodyTemplatesEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool format for RESP_BODY_TEMPLATES: %w", err)
+		}
+	}
+
+	failureRespBodyEnv := getenv("FAILURE_RESP_BODY")
 	if failureRespBodyEnv != "" {
-		if err = json.Unmarshal([]byte(failureRespBodyEnv), &cfg.failureRespBody); err != nil {
-			return nil, fmt.Errorf("invalid json format for FAILURE_RESP_BODY: %w", err)
+		if cfg.failureRespBody, err = parseRespBody(failureRespBodyEnv, cfg.respBodyTemplates); err != nil {
+			return nil, fmt.Errorf("invalid format for FAILURE_RESP_BODY: %w", err)
 		}
 	}
 
-	successCodeEnv := os.Getenv("SUCCESS_RESP_CODE")
+	successCodeEnv := getenv("SUCCESS_RESP_CODE")
 	if successCodeEnv != "" {
 		cfg.successCode, err = strconv.Atoi(successCodeEnv)
 		if err != nil {
@@ -98,16 +171,16 @@ func loadConfigFromEnv() (*config, error) {
 		cfg.successCode = http.StatusOK // default response code
 	}
 
-	successRepBodyEnv := os.Getenv("SUCCESS_RESP_BODY")
+	successRepBodyEnv := getenv("SUCCESS_RESP_BODY")
 	if successRepBodyEnv != "" {
-		if err = json.Unmarshal([]byte(successRepBodyEnv), &cfg.successRespBody); err != nil {
-			return nil, fmt.Errorf("invalid json format for SUCCESS_RESP_BODY: %w", err)
+		if cfg.successRespBody, err = parseRespBody(successRepBodyEnv, cfg.respBodyTemplates); err != nil {
+			return nil, fmt.Errorf("invalid format for SUCCESS_RESP_BODY: %w", err)
 		}
 	} else {
-		cfg.successRespBody = map[string]interface{}{"success": true} // default response body
+		cfg.successRespBody = defaultSuccessRespBody
 	}
 
-	successRatioEnv := os.Getenv("SUCCESS_RATIO")
+	successRatioEnv := getenv("SUCCESS_RATIO")
 	if successRatioEnv != "" {
 		cfg.successRatio, err = strconv.ParseFloat(successRatioEnv, 64)
 		if err != nil || cfg.successRatio <= 0 || cfg.successRatio > 1 {
@@ -117,7 +190,7 @@ func loadConfigFromEnv() (*config, error) {
 		cfg.successRatio = defaultRatio
 	}
 
-	rateLimitEnv := os.Getenv("RATE_LIMIT")
+	rateLimitEnv := getenv("RATE_LIMIT")
 	if rateLimitEnv != "" {
 		cfg.rateLimit, err = strconv.Atoi(rateLimitEnv)
 		if err != nil {
@@ -127,32 +200,316 @@ func loadConfigFromEnv() (*config, error) {
 		cfg.rateLimit = defaultRateLimit
 	}
 
-	rateExceededRespBodyEnv := os.Getenv("RATE_EXCEEDED_RESP_BODY")
+	rateExceededRespBodyEnv := getenv("RATE_EXCEEDED_RESP_BODY")
 	if rateExceededRespBodyEnv != "" {
-		if err = json.Unmarshal([]byte(rateExceededRespBodyEnv), &cfg.rateExceededRespBody); err != nil {
-			return nil, fmt.Errorf("invalid json format for RATE_EXCEEDED_RESP_BODY: %w", err)
+		if cfg.rateExceededRespBody, err = parseRespBody(rateExceededRespBodyEnv, cfg.respBodyTemplates); err != nil {
+			return nil, fmt.Errorf("invalid format for RATE_EXCEEDED_RESP_BODY: %w", err)
 		}
 	}
 
-	methodsEnv := os.Getenv("METHODS")
+	batchMaxSizeEnv := getenv("BATCH_MAX_SIZE")
+	if batchMaxSizeEnv != "" {
+		cfg.batchMaxSize, err = strconv.Atoi(batchMaxSizeEnv)
+		if err != nil || cfg.batchMaxSize <= 0 {
+			return nil, fmt.Errorf("invalid value for BATCH_MAX_SIZE")
+		}
+	} else {
+		cfg.batchMaxSize = defaultBatchSize
+	}
+
+	batchParallelismEnv := getenv("BATCH_PARALLELISM")
+	if batchParallelismEnv != "" {
+		cfg.batchParallelism, err = strconv.Atoi(batchParallelismEnv)
+		if err != nil || cfg.batchParallelism <= 0 {
+			return nil, fmt.Errorf("invalid value for BATCH_PARALLELISM")
+		}
+	} else {
+		// every request of a batch is dispatched concurrently by default
+		cfg.batchParallelism = cfg.batchMaxSize
+	}
+
+	batchTimingEnv := getenv("BATCH_TIMING")
+	if batchTimingEnv != "" {
+		cfg.batchTiming, err = strconv.ParseBool(batchTimingEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool format for BATCH_TIMING: %w", err)
+		}
+	}
+
+	methodsEnv := getenv("METHODS")
 	if methodsEnv != "" {
-		allowedMethods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch}
 		cfg.methods = strings.Split(methodsEnv, ",")
-		for _, method := range cfg.methods {
-			if !stringSliceContains(allowedMethods, method) {
-				return nil, fmt.Errorf("method %s is not allowed", method)
+		for i, method := range cfg.methods {
+			if cfg.methods[i], err = parseMethod(method); err != nil {
+				return nil, fmt.Errorf("invalid METHODS: %w", err)
 			}
 		}
 	}
 
-	subRoutesEnv := os.Getenv("SUB_ROUTES")
+	subRoutesEnv := getenv("SUB_ROUTES")
 	if subRoutesEnv != "" {
 		cfg.subRoutes = strings.Split(subRoutesEnv, ",")
+		for _, subRoute := range cfg.subRoutes {
+			if err = validateRoutePattern(subRoute); err != nil {
+				return nil, fmt.Errorf("invalid SUB_ROUTES: %w", err)
+			}
+		}
+	}
+
+	h2cEnv := getenv("H2C")
+	if h2cEnv != "" {
+		cfg.h2c, err = strconv.ParseBool(h2cEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool format for H2C: %w", err)
+		}
+	}
+
+	fakeSeedEnv := getenv("FAKE_SEED")
+	if fakeSeedEnv != "" {
+		fakeSeed, err := strconv.ParseInt(fakeSeedEnv, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int format for FAKE_SEED: %w", err)
+		}
+		cfg.fakeSeed = &fakeSeed
+	}
+
+	routesFileEnv := getenv("ROUTES_FILE")
+	if routesFileEnv != "" {
+		cfg.routes, err = loadRoutes(routesFileEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid routes file %s: %w", routesFileEnv, err)
+		}
+		for _, rt := range cfg.routes {
+			if len(rt.Claims) > 0 && cfg.jwt == nil {
+				return nil, fmt.Errorf("route %s requires claims, but neither JWT_SECRET nor JWT_JWKS_FILE are set", rt.Path)
+			}
+		}
+	}
+
+	if err = checkReservedPaths(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err = loadTLSConfig(&cfg, getenv); err != nil {
+		return nil, err
+	}
+
+	if err = loadGRPCConfig(&cfg, getenv); err != nil {
+		return nil, err
 	}
 
 	return &cfg, nil
 }
 
+// checkReservedPaths checks none of the mocked routes is shadowed by the batch and admin endpoints or,
+// when the mocked routes are served at the root level, by the health check endpoints
+func checkReservedPaths(cfg *config) error {
+	paths := append([]string{}, cfg.subRoutes...)
+	for _, rt := range cfg.routes {
+		paths = append(paths, rt.Path)
+		if rt.Job != nil {
+			paths = append(paths, rt.Job.StatusPath)
+		}
+	}
+	for _, p := range paths {
+		if cfg.uriPrefix == "" && stringSliceContains(healthPaths, p) {
+			return fmt.Errorf("route %s conflicts with the health check endpoints %v, use a URI_PREFIX other than /", p, healthPaths)
+		}
+		if p == batchPath {
+			return fmt.Errorf("route %s conflicts with the batch endpoint", p)
+		}
+		if strings.HasPrefix(p, adminPathPrefix) {
+			return fmt.Errorf("route %s conflicts with the admin endpoints under %s", p, adminPathPrefix)
+		}
+	}
+
+	return nil
+}
+
+// loadAuthConfig loads the authentication configuration from the variables returned by getenv,
+// requests being accepted with any of the configured credentials
+func loadAuthConfig(cfg *config, getenv func(string) string) error {
+	if apiKeyEnv := getenv("API_KEY"); apiKeyEnv != "" {
+		cfg.apiKeys = strings.Split(apiKeyEnv, ",")
+		if stringSliceContains(cfg.apiKeys, "") {
+			return errors.New("invalid API_KEY: empty key")
+		}
+	}
+
+	if apiTokenEnv := getenv("API_TOKEN"); apiTokenEnv != "" {
+		cfg.apiTokens = strings.Split(apiTokenEnv, ",")
+		if stringSliceContains(cfg.apiTokens, "") {
+			return errors.New("invalid API_TOKEN: empty token")
+		}
+	}
+
+	if basicAuthUsersEnv := getenv("BASIC_AUTH_USERS"); basicAuthUsersEnv != "" {
+		cfg.basicAuthUsers = map[string]string{}
+		for _, credentials := range strings.Split(basicAuthUsersEnv, ",") {
+			user, password, ok := strings.Cut(credentials, ":")
+			if !ok || user == "" {
+				return fmt.Errorf("invalid BASIC_AUTH_USERS: %q is not in the user:password format", credentials)
+			}
+			cfg.basicAuthUsers[user] = password
+		}
+	}
+
+	jwtSecretEnv, jwtJWKSFileEnv := getenv("JWT_SECRET"), getenv("JWT_JWKS_FILE")
+	if jwtSecretEnv == "" && jwtJWKSFileEnv == "" {
+		if getenv("JWT_ISSUER") != "" || getenv("JWT_AUDIENCE") != "" {
+			return errors.New("JWT_ISSUER and JWT_AUDIENCE require JWT_SECRET or JWT_JWKS_FILE")
+		}
+		return nil
+	}
+	cfg.jwt = &authn.JWTConfig{
+		Issuer:   getenv("JWT_ISSUER"),
+		Audience: getenv("JWT_AUDIENCE"),
+	}
+	if jwtSecretEnv != "" {
+		cfg.jwt.Secret = []byte(jwtSecretEnv)
+	}
+	if jwtJWKSFileEnv != "" {
+		var err error
+		if cfg.jwt.Keys, err = authn.LoadJWKS(jwtJWKSFileEnv); err != nil {
+			return fmt.Errorf("invalid JWT_JWKS_FILE %s: %w", jwtJWKSFileEnv, err)
+		}
+	}
+
+	return nil
+}
+
+// loadTLSConfig loads the TLS configuration from the variables returned by getenv
+func loadTLSConfig(cfg *config, getenv func(string) string) error {
+	var err error
+	cfg.tlsCertFile = getenv("TLS_CERT_FILE")
+	cfg.tlsKeyFile = getenv("TLS_KEY_FILE")
+	if (cfg.tlsCertFile == "") != (cfg.tlsKeyFile == "") {
+		return errors.New("both TLS_CERT_FILE and TLS_KEY_FILE must be set")
+	}
+
+	tlsAutoCertEnv := getenv("TLS_AUTO_CERT")
+	if tlsAutoCertEnv != "" {
+		cfg.tlsAutoCert, err = strconv.ParseBool(tlsAutoCertEnv)
+		if err != nil {
+			return fmt.Errorf("invalid bool format for TLS_AUTO_CERT: %w", err)
+		}
+	}
+	if cfg.tlsAutoCert && cfg.tlsCertFile != "" {
+		return errors.New("only one of TLS_AUTO_CERT or TLS_CERT_FILE can be set")
+	}
+	if !cfg.tlsAutoCert && cfg.tlsCertFile == "" {
+		if getenv("TLS_CLIENT_CA_FILE") != "" {
+			return errors.New("TLS_CLIENT_CA_FILE requires TLS to be enabled")
+		}
+		return nil // TLS disabled
+	}
+
+	cfg.tlsPort = defaultTLSPort
+	tlsPortEnv := getenv("TLS_PORT")
+	if tlsPortEnv != "" {
+		cfg.tlsPort, err = strconv.Atoi(tlsPortEnv)
+		if err != nil {
+			return fmt.Errorf("invalid int format for TLS_PORT: %w", err)
+		}
+	}
+	if cfg.tlsPort == cfg.port {
+		return errors.New("TLS_PORT must be different from PORT")
+	}
+
+	if cfg.tlsAutoCert {
+		cfg.tlsCertDir = defaultTLSDir
+		if tlsCertDirEnv := getenv("TLS_CERT_DIR"); tlsCertDirEnv != "" {
+			cfg.tlsCertDir = tlsCertDirEnv
+		}
+		cfg.tlsHosts = defaultTLSHosts
+		if tlsHostsEnv := getenv("TLS_HOSTS"); tlsHostsEnv != "" {
+			cfg.tlsHosts = strings.Split(tlsHostsEnv, ",")
+		}
+	}
+
+	cfg.tlsClientCAFile = getenv("TLS_CLIENT_CA_FILE")
+	if cfg.tlsClientCAFile != "" {
+		cfg.tlsClientAuth = clientAuthRequire
+		if tlsClientAuthEnv := getenv("TLS_CLIENT_AUTH"); tlsClientAuthEnv != "" {
+			cfg.tlsClientAuth = tlsClientAuthEnv
+		}
+		if cfg.tlsClientAuth != clientAuthRequire && cfg.tlsClientAuth != clientAuthOptional {
+			return fmt.Errorf("invalid value for TLS_CLIENT_AUTH: %s", cfg.tlsClientAuth)
+		}
+
+		cfg.tlsClientIdentity = identityCommonName
+		if tlsClientIdentityEnv := getenv("TLS_CLIENT_IDENTITY"); tlsClientIdentityEnv != "" {
+			cfg.tlsClientIdentity = tlsClientIdentityEnv
+		}
+		if !stringSliceContains(identityFields, cfg.tlsClientIdentity) {
+			return fmt.Errorf("invalid value for TLS_CLIENT_IDENTITY: %s", cfg.tlsClientIdentity)
+		}
+	}
+
+	return nil
+}
+
+// loadGRPCConfig loads the gRPC configuration from the variables returned by getenv
+func loadGRPCConfig(cfg *config, getenv func(string) string) error {
+	grpcDescriptorsEnv := getenv("GRPC_DESCRIPTORS")
+	if grpcDescriptorsEnv == "" {
+		if getenv("GRPC_PORT") != "" || getenv("GRPC_METHODS_FILE") != "" {
+			return errors.New("GRPC_PORT and GRPC_METHODS_FILE require GRPC_DESCRIPTORS")
+		}
+		return nil // gRPC disabled
+	}
+
+	var err error
+	cfg.grpcPort = defaultGRPCPort
+	if grpcPortEnv := getenv("GRPC_PORT"); grpcPortEnv != "" {
+		cfg.grpcPort, err = strconv.Atoi(grpcPortEnv)
+		if err != nil {
+			return fmt.Errorf("invalid int format for GRPC_PORT: %w", err)
+		}
+	}
+	if cfg.grpcPort == cfg.port || cfg.grpcPort == cfg.tlsPort {
+		return errors.New("GRPC_PORT must be different from PORT and TLS_PORT")
+	}
+
+	cfg.grpcServices, err = loadGRPCServices(strings.Split(grpcDescriptorsEnv, ","))
+	if err != nil {
+		return fmt.Errorf("invalid GRPC_DESCRIPTORS: %w", err)
+	}
+
+	if grpcMethodsFileEnv := getenv("GRPC_METHODS_FILE"); grpcMethodsFileEnv != "" {
+		if err = cfg.grpcServices.loadMethods(grpcMethodsFileEnv); err != nil {
+			return fmt.Errorf("invalid gRPC methods file %s: %w", grpcMethodsFileEnv, err)
+		}
+	}
+
+	return nil
+}
+
+// parseMethod validates an HTTP method and returns it in upper case (as routed), registering
+// it in the router if it's not a standard method (e.g. PROPFIND or PURGE)
+func parseMethod(method string) (_ string, err error) {
+	// methods are tokens (RFC 9110, section 5.6.2)
+	isTokenChar := func(r rune) bool {
+		return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r))
+	}
+	if method == "" || strings.IndexFunc(method, func(r rune) bool { return !isTokenChar(r) }) != -1 {
+		return "", fmt.Errorf("method %q is not a valid HTTP method", method)
+	}
+	method = strings.ToUpper(method)
+
+	// chi panics when registering too many custom methods
+	registerMethodMu.Lock()
+	defer registerMethodMu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("method %s can't be registered: %v", method, r)
+		}
+	}()
+	chi.RegisterMethod(method)
+
+	return method, nil
+}
+
 // stringSliceContains is a helper function to detect whether a string slice contains a string or not
 func stringSliceContains(s []string, e string) bool {
 	for _, a := range s {
@@ -1,16 +1,26 @@
 package service
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+
+	"github.com/juan131/api-mock/pkg/authn"
 )
 
 func Test_loadConfigFromEnv(t *testing.T) {
 	type env struct {
-		port, apiKey, apiToken, respDelay, failureRespCode, failureRespBody, successRespCode, successRespBody, successRatio, rateLimit, rateExceededRespBody, methods, subRoutes string
+		host, port, uriPrefix, apiKey, apiToken, basicAuthUsers, respDelay, respBodyTemplates, failureRespCode, failureRespBody, successRespCode, successRespBody, successRatio, rateLimit, batchMaxSize, batchParallelism, batchTiming, rateExceededRespBody, methods, subRoutes, fakeSeed, h2c string
+
+		tlsPort, tlsCertFile, tlsKeyFile, tlsAutoCert, tlsCertDir, tlsHosts, tlsClientCAFile, tlsClientAuth, tlsClientIdentity string
+
+		grpcPort, grpcDescriptors, grpcMethodsFile string
+
+		jwtSecret, jwtJWKSFile, jwtIssuer, jwtAudience string
 	}
+	protoFile := writeGreeterProto(t)
 	tests := []struct {
 		name    string
 		env     env
@@ -21,12 +31,15 @@ func Test_loadConfigFromEnv(t *testing.T) {
 			name: "Valid configuration (defaults)",
 			want: &config{
 				port:                 8080,
+				uriPrefix:            "/v1/mock",
 				failureCode:          http.StatusBadRequest,
 				failureRespBody:      nil,
 				successCode:          http.StatusOK,
-				successRespBody:      map[string]interface{}{"success": true},
+				successRespBody:      json.RawMessage(`{"success":true}`),
 				successRatio:         1.0,
 				rateLimit:            1000,
+				batchMaxSize:         50,
+				batchParallelism:     50,
 				rateExceededRespBody: nil,
 			},
 			wantErr: false,
@@ -42,30 +55,475 @@ func Test_loadConfigFromEnv(t *testing.T) {
 				successRespBody:      `{"success": true}`,
 				successRatio:         "0.5",
 				rateLimit:            "10",
+				batchMaxSize:         "100",
+				batchParallelism:     "4",
+				batchTiming:          "true",
 				rateExceededRespBody: `{"success": false, "error": "rate limit exceeded"}`,
 				methods:              "GET,POST,PUT",
 				subRoutes:            "/foo,/bar",
 			},
 			want: &config{
 				port:                 8080,
-				apiToken:             "some-token",
+				uriPrefix:            "/v1/mock",
+				apiTokens:            []string{"some-token"},
 				failureCode:          http.StatusBadRequest,
-				failureRespBody:      map[string]interface{}{"success": false},
+				failureRespBody:      json.RawMessage(`{"success": false}`),
 				successCode:          http.StatusOK,
-				successRespBody:      map[string]interface{}{"success": true},
+				successRespBody:      json.RawMessage(`{"success": true}`),
 				successRatio:         0.5,
 				rateLimit:            10,
-				rateExceededRespBody: map[string]interface{}{"success": false, "error": "rate limit exceeded"},
+				batchMaxSize:         100,
+				batchParallelism:     4,
+				batchTiming:          true,
+				rateExceededRespBody: json.RawMessage(`{"success": false, "error": "rate limit exceeded"}`),
 				methods:              []string{"GET", "POST", "PUT"},
 				subRoutes:            []string{"/foo", "/bar"},
 			},
 			wantErr: false,
 		},
 		{
-			name: "Both API key and token set",
+			name: "Valid configuration (non-object bodies)",
+			env: env{
+				failureRespBody:      `"failed"`,
+				successRespBody:      `[{"id": 1}, {"id": 2}]`,
+				rateExceededRespBody: `null`,
+			},
+			want: &config{
+				port:                 8080,
+				uriPrefix:            "/v1/mock",
+				failureCode:          http.StatusBadRequest,
+				failureRespBody:      json.RawMessage(`"failed"`),
+				successCode:          http.StatusOK,
+				successRespBody:      json.RawMessage(`[{"id": 1}, {"id": 2}]`),
+				successRatio:         1.0,
+				rateLimit:            1000,
+				batchMaxSize:         50,
+				batchParallelism:     50,
+				rateExceededRespBody: json.RawMessage(`null`),
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (batch parallelism bounded by the batch size)",
+			env: env{
+				batchMaxSize: "10",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  defaultSuccessRespBody,
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     10,
+				batchParallelism: 10,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (several credentials)",
+			env: env{
+				apiKey:         "some-key,other-key",
+				apiToken:       "some-token",
+				basicAuthUsers: "alice:secret,bob:p@ss:word",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				apiKeys:          []string{"some-key", "other-key"},
+				apiTokens:        []string{"some-token"},
+				basicAuthUsers:   map[string]string{"alice": "secret", "bob": "p@ss:word"},
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  defaultSuccessRespBody,
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (templated bodies)",
+			env: env{
+				successRespBody:   `[{{range $i, $_ := seq 3}}{{if $i}},{{end}}{"id": {{int 1 100}}, "name": "{{name}}"}{{end}}]`,
+				fakeSeed:          "42",
+				respBodyTemplates: "true",
+			},
+			want: &config{
+				port:              8080,
+				uriPrefix:         "/v1/mock",
+				failureCode:       http.StatusBadRequest,
+				successCode:       http.StatusOK,
+				successRespBody:   json.RawMessage(`[{{range $i, $_ := seq 3}}{{if $i}},{{end}}{"id": {{int 1 100}}, "name": "{{name}}"}{{end}}]`),
+				successRatio:      1.0,
+				rateLimit:         1000,
+				batchMaxSize:      50,
+				batchParallelism:  50,
+				fakeSeed:          func() *int64 { seed := int64(42); return &seed }(),
+				respBodyTemplates: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (literal template delimiters)",
+			env: env{
+				successRespBody: `{"pattern": "{{name}}"}`,
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"pattern": "{{"{{"}}name}}"}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid body template",
+			env: env{
+				successRespBody:   `{"name": "{{unknownFunc}}"}`,
+				respBodyTemplates: "true",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid body templates flag",
 			env: env{
-				apiKey:   "some-key",
-				apiToken: "some-token",
+				respBodyTemplates: "sometimes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Valid configuration (URI prefix, host ignored without APIs file)",
+			env: env{
+				host:      "Payments.Example.com",
+				uriPrefix: "/payments/v2/",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/payments/v2",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (root-level routes)",
+			env: env{
+				uriPrefix: "/",
+				subRoutes: "/users,/orders",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+				subRoutes:        []string{"/users", "/orders"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (non-canonical URI prefix)",
+			env: env{
+				uriPrefix: "/api//v1/./",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/api/v1",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Root-level route conflicting with health checks",
+			env: env{
+				uriPrefix: "/",
+				subRoutes: "/users,/live",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Route conflicting with admin endpoints",
+			env: env{
+				subRoutes: "/users,/__admin/events/{name}",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Route conflicting with the batch endpoint",
+			env: env{
+				subRoutes: "/users,/batch",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Valid configuration (custom methods)",
+			env: env{
+				methods: "HEAD,OPTIONS,propfind,PURGE",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				methods:          []string{"HEAD", "OPTIONS", "PROPFIND", "PURGE"},
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid sub route",
+			env: env{
+				subRoutes: "/users/{id:[0-9+}",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid URI prefix",
+			env: env{
+				uriPrefix: "v1/mock",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid fake seed",
+			env: env{
+				fakeSeed: "not-a-number",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Valid configuration (h2c)",
+			env: env{
+				h2c: "true",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+				h2c:              true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid h2c",
+			env: env{
+				h2c: "maybe",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Valid configuration (TLS with auto-generated certificate)",
+			env: env{
+				tlsAutoCert: "true",
+				tlsHosts:    "localhost,api.test",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+				tlsPort:          8443,
+				tlsAutoCert:      true,
+				tlsCertDir:       "certs",
+				tlsHosts:         []string{"localhost", "api.test"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (TLS with provided certificate)",
+			env: env{
+				tlsPort:     "9443",
+				tlsCertFile: "/certs/tls.crt",
+				tlsKeyFile:  "/certs/tls.key",
+			},
+			want: &config{
+				port:             8080,
+				uriPrefix:        "/v1/mock",
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  json.RawMessage(`{"success":true}`),
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+				tlsPort:          9443,
+				tlsCertFile:      "/certs/tls.crt",
+				tlsKeyFile:       "/certs/tls.key",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid configuration (mutual TLS)",
+			env: env{
+				tlsCertFile:     "/certs/tls.crt",
+				tlsKeyFile:      "/certs/tls.key",
+				tlsClientCAFile: "/certs/clients-ca.crt",
+				tlsClientAuth:   "optional",
+			},
+			want: &config{
+				port:              8080,
+				uriPrefix:         "/v1/mock",
+				failureCode:       http.StatusBadRequest,
+				successCode:       http.StatusOK,
+				successRespBody:   json.RawMessage(`{"success":true}`),
+				successRatio:      1.0,
+				rateLimit:         1000,
+				batchMaxSize:      50,
+				batchParallelism:  50,
+				tlsPort:           8443,
+				tlsCertFile:       "/certs/tls.crt",
+				tlsKeyFile:        "/certs/tls.key",
+				tlsClientCAFile:   "/certs/clients-ca.crt",
+				tlsClientAuth:     "optional",
+				tlsClientIdentity: "cn",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Mutual TLS without TLS",
+			env: env{
+				tlsClientCAFile: "/certs/clients-ca.crt",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid client identity mapping",
+			env: env{
+				tlsAutoCert:       "true",
+				tlsClientCAFile:   "/certs/clients-ca.crt",
+				tlsClientIdentity: "serial",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "TLS certificate without key",
+			env: env{
+				tlsCertFile: "/certs/tls.crt",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Both TLS auto-generated and provided certificates",
+			env: env{
+				tlsAutoCert: "true",
+				tlsCertFile: "/certs/tls.crt",
+				tlsKeyFile:  "/certs/tls.key",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Same port for TLS and plain HTTP",
+			env: env{
+				tlsAutoCert: "true",
+				tlsPort:     "8080",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid basic auth users",
+			env: env{
+				basicAuthUsers: "alice:secret,bob",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Valid configuration (JWT)",
+			env: env{
+				jwtSecret:   "some-secret",
+				jwtIssuer:   "https://issuer.example.com",
+				jwtAudience: "api-mock",
+			},
+			want: &config{
+				port:      8080,
+				uriPrefix: "/v1/mock",
+				jwt: &authn.JWTConfig{
+					Secret:   []byte("some-secret"),
+					Issuer:   "https://issuer.example.com",
+					Audience: "api-mock",
+				},
+				failureCode:      http.StatusBadRequest,
+				successCode:      http.StatusOK,
+				successRespBody:  defaultSuccessRespBody,
+				successRatio:     1.0,
+				rateLimit:        1000,
+				batchMaxSize:     50,
+				batchParallelism: 50,
+			},
+			wantErr: false,
+		},
+		{
+			name: "JWT issuer without secret or JWKS",
+			env: env{
+				jwtIssuer: "https://issuer.example.com",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Missing JWKS file",
+			env: env{
+				jwtJWKSFile: "/does/not/exist.json",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid API key",
+			env: env{
+				apiKey: "some-key,",
 			},
 			want:    nil,
 			wantErr: true,
@@ -125,6 +583,30 @@ func Test_loadConfigFromEnv(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "Invalid batch max size",
+			env: env{
+				batchMaxSize: "0",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid batch parallelism",
+			env: env{
+				batchParallelism: "-1",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid batch timing",
+			env: env{
+				batchTiming: "sometimes",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "Invalid rate exceeded response body",
 			env: env{
@@ -144,7 +626,41 @@ func Test_loadConfigFromEnv(t *testing.T) {
 		{
 			name: "Invalid methods",
 			env: env{
-				methods: "JUMP,RUN,FLY",
+				methods: "GET,NOT A METHOD",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "gRPC port without descriptors",
+			env: env{
+				grpcPort: "9090",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid gRPC descriptors",
+			env: env{
+				grpcDescriptors: "missing.proto",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "gRPC port conflict",
+			env: env{
+				port:            "9090",
+				grpcDescriptors: protoFile,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid gRPC methods file",
+			env: env{
+				grpcDescriptors: protoFile,
+				grpcMethodsFile: "missing.json",
 			},
 			want:    nil,
 			wantErr: true,
@@ -153,9 +669,12 @@ func Test_loadConfigFromEnv(t *testing.T) {
 	for _, testToRun := range tests {
 		test := testToRun
 		t.Run(test.name, func(tt *testing.T) {
+			tt.Setenv("HOST", test.env.host)
 			tt.Setenv("PORT", test.env.port)
+			tt.Setenv("URI_PREFIX", test.env.uriPrefix)
 			tt.Setenv("API_KEY", test.env.apiKey)
 			tt.Setenv("API_TOKEN", test.env.apiToken)
+			tt.Setenv("BASIC_AUTH_USERS", test.env.basicAuthUsers)
 			tt.Setenv("RESP_DELAY", test.env.respDelay)
 			tt.Setenv("FAILURE_RESP_CODE", test.env.failureRespCode)
 			tt.Setenv("FAILURE_RESP_BODY", test.env.failureRespBody)
@@ -163,9 +682,31 @@ func Test_loadConfigFromEnv(t *testing.T) {
 			tt.Setenv("SUCCESS_RESP_BODY", test.env.successRespBody)
 			tt.Setenv("SUCCESS_RATIO", test.env.successRatio)
 			tt.Setenv("RATE_LIMIT", test.env.rateLimit)
+			tt.Setenv("BATCH_MAX_SIZE", test.env.batchMaxSize)
+			tt.Setenv("BATCH_PARALLELISM", test.env.batchParallelism)
+			tt.Setenv("BATCH_TIMING", test.env.batchTiming)
 			tt.Setenv("RATE_EXCEEDED_RESP_BODY", test.env.rateExceededRespBody)
 			tt.Setenv("METHODS", test.env.methods)
 			tt.Setenv("SUB_ROUTES", test.env.subRoutes)
+			tt.Setenv("FAKE_SEED", test.env.fakeSeed)
+			tt.Setenv("RESP_BODY_TEMPLATES", test.env.respBodyTemplates)
+			tt.Setenv("H2C", test.env.h2c)
+			tt.Setenv("TLS_PORT", test.env.tlsPort)
+			tt.Setenv("TLS_CERT_FILE", test.env.tlsCertFile)
+			tt.Setenv("TLS_KEY_FILE", test.env.tlsKeyFile)
+			tt.Setenv("TLS_AUTO_CERT", test.env.tlsAutoCert)
+			tt.Setenv("TLS_CERT_DIR", test.env.tlsCertDir)
+			tt.Setenv("TLS_HOSTS", test.env.tlsHosts)
+			tt.Setenv("TLS_CLIENT_CA_FILE", test.env.tlsClientCAFile)
+			tt.Setenv("TLS_CLIENT_AUTH", test.env.tlsClientAuth)
+			tt.Setenv("TLS_CLIENT_IDENTITY", test.env.tlsClientIdentity)
+			tt.Setenv("GRPC_PORT", test.env.grpcPort)
+			tt.Setenv("GRPC_DESCRIPTORS", test.env.grpcDescriptors)
+			tt.Setenv("GRPC_METHODS_FILE", test.env.grpcMethodsFile)
+			tt.Setenv("JWT_SECRET", test.env.jwtSecret)
+			tt.Setenv("JWT_JWKS_FILE", test.env.jwtJWKSFile)
+			tt.Setenv("JWT_ISSUER", test.env.jwtIssuer)
+			tt.Setenv("JWT_AUDIENCE", test.env.jwtAudience)
 
 			got, err := loadConfigFromEnv()
 			if (err != nil) != test.wantErr {
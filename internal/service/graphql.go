@@ -0,0 +1,479 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// graphQL is the definition of a GraphQL route
+type graphQL struct {
+	Schema     string                     `json:"schema"`     // schema definition (SDL)
+	SchemaFile string                     `json:"schemaFile"` // file with the schema definition (SDL)
+	Fixtures   map[string]json.RawMessage `json:"fixtures"`   // field values by "Type.field", generated from the schema if not set
+	Errors     []json.RawMessage          `json:"errors"`     // errors returned on failure
+	schema     *ast.Schema                // parsed schema
+	fixtures   map[string]*gqlFixture     // parsed fixtures
+}
+
+// gqlFixture is the value of a field defined in a GraphQL route
+type gqlFixture struct {
+	template []byte      // JSON template rendered with the field arguments (if any)
+	value    interface{} // decoded value (if not a template)
+}
+
+// gqlRequest is a GraphQL request
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlObject is a GraphQL object whose fields are encoded in the order they were selected
+type gqlObject []gqlField
+
+// gqlField is a field of a GraphQL object
+type gqlField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// validate checks the GraphQL route definition, parsing its schema and fixtures
+func (gql *graphQL) validate() error {
+	if (gql.Schema == "") == (gql.SchemaFile == "") {
+		return errors.New("one of schema or schemaFile is required")
+	}
+	source := &ast.Source{Name: "schema", Input: gql.Schema}
+	if gql.SchemaFile != "" {
+		data, err := os.ReadFile(gql.SchemaFile)
+		if err != nil {
+			return err
+		}
+		source = &ast.Source{Name: gql.SchemaFile, Input: string(data)}
+	}
+
+	var err error
+	if gql.schema, err = gqlparser.LoadSchema(source); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	if gql.schema.Query == nil {
+		return errors.New("invalid schema: the Query type is required")
+	}
+
+	gql.fixtures = make(map[string]*gqlFixture, len(gql.Fixtures))
+	for key, value := range gql.Fixtures {
+		typeName, fieldName, _ := strings.Cut(key, ".")
+		def := gql.schema.Types[typeName]
+		if def == nil || def.Kind != ast.Object || def.Fields.ForName(fieldName) == nil {
+			return fmt.Errorf("fixture %s: unknown field, fixtures must be keyed by Type.field", key)
+		}
+
+		fixture := &gqlFixture{}
+		body, err := parseJSONTemplate(value)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", key, err)
+		}
+		if isTemplate(body) {
+			fixture.template = body
+		} else if err = json.Unmarshal(body, &fixture.value); err != nil {
+			return fmt.Errorf("fixture %s: %w", key, err)
+		}
+		gql.fixtures[key] = fixture
+	}
+
+	for i, gqlErr := range gql.Errors {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if err = json.Unmarshal(gqlErr, &e); err != nil || e.Message == "" {
+			return fmt.Errorf("error %d: errors must be objects with a message", i)
+		}
+	}
+
+	return nil
+}
+
+// handleGraphQL mocks the response of a GraphQL route, rejecting invalid queries
+func (svc *service) handleGraphQL(w http.ResponseWriter, r *http.Request, gql *graphQL) {
+	req, err := parseGraphQLRequest(w, r)
+	if err != nil {
+		svc.LogRequestFailure(r, "[handleGraphQL] invalid request", err)
+		status := http.StatusBadRequest
+		if isBodyTooLarge(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		renderJSON(w, r, status, map[string]interface{}{"errors": gqlerror.List{gqlerror.Wrap(err)}})
+		return
+	}
+
+	doc, errs := gqlparser.LoadQuery(gql.schema, req.Query)
+	if len(errs) > 0 {
+		svc.LogRequestFailure(r, "[handleGraphQL] invalid query", errs)
+		renderJSON(w, r, http.StatusBadRequest, map[string]interface{}{"errors": errs})
+		return
+	}
+	op, vars, err := gqlOperation(gql.schema, doc, req, r.Method)
+	if err != nil {
+		svc.LogRequestFailure(r, "[handleGraphQL] invalid operation", err)
+		renderJSON(w, r, http.StatusBadRequest, map[string]interface{}{"errors": gqlerror.List{gqlerror.Wrap(err)}})
+		return
+	}
+
+	svc.mockResponse(w, r, func(w http.ResponseWriter, r *http.Request) {
+		exec := &gqlExecution{svc: svc, gql: gql, r: r, vars: vars}
+		root := gql.schema.Query
+		if op.Operation == ast.Mutation {
+			root = gql.schema.Mutation
+		}
+		resp := map[string]interface{}{"data": exec.executeSelectionSet(root, map[string]interface{}{}, op.SelectionSet, nil)}
+		if len(exec.errors) > 0 {
+			resp["errors"] = exec.errors
+		}
+		renderJSON(w, r, http.StatusOK, resp)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		var gqlErrors interface{} = gql.Errors
+		if len(gql.Errors) == 0 {
+			logID := svc.LogRequestFailure(r, "[handleGraphQL] failed request", nil)
+			gqlErrors = gqlerror.List{{
+				Message:    "failed request",
+				Extensions: map[string]interface{}{"code": api.CodeFailedRequest, "id": logID},
+			}}
+		}
+		renderJSON(w, r, http.StatusOK, map[string]interface{}{"data": nil, "errors": gqlErrors})
+	})
+}
+
+// parseGraphQLRequest parses a GraphQL request, sent either as query parameters
+// (GET requests) or as a JSON or application/graphql body (POST requests)
+func parseGraphQLRequest(w http.ResponseWriter, r *http.Request) (*gqlRequest, error) {
+	req := &gqlRequest{}
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return nil, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+	} else {
+		body, err := readBody(w, r, maxBodySize)
+		if err != nil {
+			return nil, err
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+			req.Query = string(body)
+		} else if err = json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("invalid json body: %w", err)
+		}
+	}
+
+	if req.Query == "" {
+		return nil, errors.New("query is required")
+	}
+
+	return req, nil
+}
+
+// gqlOperation returns the operation to execute and its coerced variables
+func gqlOperation(schema *ast.Schema, doc *ast.QueryDocument, req *gqlRequest, method string) (*ast.OperationDefinition, map[string]interface{}, error) {
+	var op *ast.OperationDefinition
+	switch {
+	case req.OperationName != "":
+		if op = doc.Operations.ForName(req.OperationName); op == nil {
+			return nil, nil, fmt.Errorf("unknown operation %s", req.OperationName)
+		}
+	case len(doc.Operations) == 1:
+		op = doc.Operations[0]
+	default:
+		return nil, nil, errors.New("operationName is required for documents with several operations")
+	}
+
+	switch {
+	case op.Operation == ast.Subscription:
+		return nil, nil, errors.New("subscriptions are not supported")
+	case op.Operation == ast.Mutation && method != http.MethodPost:
+		return nil, nil, errors.New("mutations require POST requests")
+	}
+
+	vars, err := validator.VariableValues(schema, op, req.Variables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return op, vars, nil
+}
+
+// gqlExecution is the execution of a GraphQL operation
+type gqlExecution struct {
+	svc    *service
+	gql    *graphQL
+	r      *http.Request
+	vars   map[string]interface{}
+	errors gqlerror.List
+}
+
+// executeSelectionSet resolves the selected fields of an object, taking their values from
+// the object (if defined by a fixture), from the fixtures of the fields or generating them
+func (e *gqlExecution) executeSelectionSet(objType *ast.Definition, obj map[string]interface{}, sels ast.SelectionSet, path ast.Path) gqlObject {
+	var fields []*ast.Field
+	e.collectFields(objType, sels, &fields, map[string]int{})
+
+	out := make(gqlObject, 0, len(fields))
+	for _, f := range fields {
+		fieldPath := append(append(ast.Path{}, path...), ast.PathName(f.Alias))
+		out = append(out, gqlField{key: f.Alias, value: e.resolveField(objType, obj, f, fieldPath)})
+	}
+
+	return out
+}
+
+// collectFields collects the fields selected for an object type, including those selected
+// via fragments, merging the fields selected several times with the same response key
+func (e *gqlExecution) collectFields(objType *ast.Definition, sels ast.SelectionSet, fields *[]*ast.Field, seen map[string]int) {
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *ast.Field:
+			if e.skip(s.Directives) {
+				continue
+			}
+			if i, found := seen[s.Alias]; found {
+				merged := *(*fields)[i]
+				merged.SelectionSet = append(append(ast.SelectionSet{}, merged.SelectionSet...), s.SelectionSet...)
+				(*fields)[i] = &merged
+				continue
+			}
+			seen[s.Alias] = len(*fields)
+			*fields = append(*fields, s)
+		case *ast.InlineFragment:
+			if !e.skip(s.Directives) && (s.TypeCondition == "" || e.typeApplies(objType, s.TypeCondition)) {
+				e.collectFields(objType, s.SelectionSet, fields, seen)
+			}
+		case *ast.FragmentSpread:
+			if !e.skip(s.Directives) && s.Definition != nil && e.typeApplies(objType, s.Definition.TypeCondition) {
+				e.collectFields(objType, s.Definition.SelectionSet, fields, seen)
+			}
+		}
+	}
+}
+
+// skip returns true if a selection is excluded via the @skip or @include directives
+func (e *gqlExecution) skip(directives ast.DirectiveList) bool {
+	if d := directives.ForName("skip"); d != nil && d.ArgumentMap(e.vars)["if"] == true {
+		return true
+	}
+	if d := directives.ForName("include"); d != nil && d.ArgumentMap(e.vars)["if"] == false {
+		return true
+	}
+
+	return false
+}
+
+// typeApplies returns true if a fragment with the given type condition applies to an object type
+func (e *gqlExecution) typeApplies(objType *ast.Definition, typeCondition string) bool {
+	if objType.Name == typeCondition {
+		return true
+	}
+	if def := e.gql.schema.Types[typeCondition]; def != nil && def.IsAbstractType() {
+		for _, possible := range e.gql.schema.GetPossibleTypes(def) {
+			if possible.Name == objType.Name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resolveField resolves the value of a field of an object
+func (e *gqlExecution) resolveField(objType *ast.Definition, obj map[string]interface{}, f *ast.Field, path ast.Path) interface{} {
+	if f.Name == "__typename" {
+		return objType.Name
+	}
+
+	value, found := obj[f.Name]
+	if !found {
+		if fixture, ok := e.gql.fixtures[objType.Name+"."+f.Name]; ok {
+			var err error
+			if value, err = e.fixtureValue(fixture, f.ArgumentMap(e.vars)); err != nil {
+				e.errors = append(e.errors, gqlerror.ErrorPathf(path, "fixture error: %v", err))
+				return nil
+			}
+			found = true
+		}
+	}
+
+	return e.completeValue(f.Definition.Type, value, found, f, path)
+}
+
+// fixtureValue returns the value of a fixture, rendering its template (if any) with the field arguments
+func (e *gqlExecution) fixtureValue(fixture *gqlFixture, args map[string]interface{}) (interface{}, error) {
+	if fixture.template == nil {
+		return fixture.value, nil
+	}
+
+	data := e.svc.newTemplateData(e.r)
+	data.Args = args
+	rendered, err := e.svc.renderTemplate(fixture.template, data)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err = json.Unmarshal(rendered, &value); err != nil {
+		return nil, fmt.Errorf("rendered fixture is not valid json: %w", err)
+	}
+
+	return value, nil
+}
+
+// completeValue completes the value of a field based on its type, generating it if not found
+func (e *gqlExecution) completeValue(typ *ast.Type, value interface{}, found bool, f *ast.Field, path ast.Path) interface{} {
+	if found && value == nil {
+		if typ.NonNull {
+			e.errors = append(e.errors, gqlerror.ErrorPathf(path, "null value for non-null field %s", f.Name))
+		}
+		return nil
+	}
+
+	if typ.Elem != nil {
+		var items []interface{}
+		if found {
+			var ok bool
+			if items, ok = value.([]interface{}); !ok {
+				e.errors = append(e.errors, gqlerror.ErrorPathf(path, "fixture value for %s is not a list", f.Name))
+				return nil
+			}
+		} else {
+			items = make([]interface{}, e.svc.fakeGenerator().Int(1, 3))
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			itemPath := append(append(ast.Path{}, path...), ast.PathIndex(i))
+			out[i] = e.completeValue(typ.Elem, item, found, f, itemPath)
+		}
+		return out
+	}
+
+	def := e.gql.schema.Types[typ.NamedType]
+	if def.IsLeafType() {
+		if found {
+			return value
+		}
+		return e.generateLeaf(def, f.Name)
+	}
+
+	obj := map[string]interface{}{}
+	if found {
+		var ok bool
+		if obj, ok = value.(map[string]interface{}); !ok {
+			e.errors = append(e.errors, gqlerror.ErrorPathf(path, "fixture value for %s is not an object", f.Name))
+			return nil
+		}
+	}
+	objType := def
+	if def.IsAbstractType() {
+		possible := e.gql.schema.GetPossibleTypes(def)
+		if len(possible) == 0 {
+			e.errors = append(e.errors, gqlerror.ErrorPathf(path, "no object type implements %s", def.Name))
+			return nil
+		}
+		objType = possible[e.svc.fakeGenerator().Intn(len(possible))]
+		if typeName, ok := obj["__typename"].(string); ok {
+			for _, p := range possible {
+				if p.Name == typeName {
+					objType = p
+				}
+			}
+		}
+	}
+
+	return e.executeSelectionSet(objType, obj, f.SelectionSet, path)
+}
+
+// generateLeaf generates a value for a scalar or enum type, based on the field name for strings
+func (e *gqlExecution) generateLeaf(def *ast.Definition, fieldName string) interface{} {
+	g := e.svc.fakeGenerator()
+	if def.Kind == ast.Enum {
+		values := make([]string, 0, len(def.EnumValues))
+		for _, v := range def.EnumValues {
+			values = append(values, v.Name)
+		}
+		return g.Pick(values...)
+	}
+
+	switch def.Name {
+	case "Int":
+		return g.Int(1, 1000)
+	case "Float":
+		return g.Float(0, 1000)
+	case "Boolean":
+		return g.Bool()
+	case "ID":
+		return g.UUID()
+	}
+
+	name := strings.ToLower(fieldName)
+	switch {
+	case strings.Contains(name, "email"):
+		return g.Email()
+	case strings.Contains(name, "firstname"):
+		return g.FirstName()
+	case strings.Contains(name, "lastname"):
+		return g.LastName()
+	case strings.Contains(name, "username"):
+		return g.Username()
+	case strings.Contains(name, "company"):
+		return g.Company()
+	case strings.Contains(name, "name"):
+		return g.Name()
+	case strings.Contains(name, "phone"):
+		return g.Phone()
+	case strings.Contains(name, "city"):
+		return g.City()
+	case strings.Contains(name, "country"):
+		return g.Country()
+	case strings.Contains(name, "address"):
+		return g.Address()
+	case strings.Contains(name, "date"), strings.Contains(name, "time"), strings.HasSuffix(fieldName, "At"):
+		return g.Time(defaultDateFrom, defaultDateTo).Format(time.RFC3339)
+	default:
+		return g.Words(2)
+	}
+}
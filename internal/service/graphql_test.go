@@ -0,0 +1,253 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testGraphQLSchema = `
+type Query {
+  user(id: ID!): User
+  users(role: Role): [User!]!
+  search(term: String!): [SearchResult!]!
+}
+
+type Mutation {
+  createUser(name: String!): User!
+}
+
+enum Role { ADMIN USER }
+
+interface Node { id: ID! }
+
+type User implements Node {
+  id: ID!
+  name: String!
+  email: String!
+  role: Role!
+  age: Int
+}
+
+type Post implements Node {
+  id: ID!
+  title: String!
+}
+
+union SearchResult = User | Post
+`
+
+func Test_service_handleGraphQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		body     string
+		query    string
+		ratio    float64
+		wantCode int
+		validate func(tt *testing.T, body string)
+	}{
+		{
+			name:     "query resolved from fixtures",
+			method:   http.MethodPost,
+			body:     `{"query": "query GetUser($id: ID!) { user(id: $id) { name id ... on User { role } } }", "variables": {"id": "42"}}`,
+			wantCode: http.StatusOK,
+			validate: func(tt *testing.T, body string) {
+				want := `{"data":{"user":{"name":"Jane","id":"42","role":"ADMIN"}}}`
+				if body != want {
+					tt.Errorf("expected body %s, got %s", want, body)
+				}
+			},
+		},
+		{
+			name:     "query with aliases, typename and skipped fields",
+			method:   http.MethodGet,
+			query:    `?query=` + strings.ReplaceAll(`{ me: user(id: "1") { __typename fullName: name age @skip(if: true) } }`, " ", "+"),
+			wantCode: http.StatusOK,
+			validate: func(tt *testing.T, body string) {
+				want := `{"data":{"me":{"__typename":"User","fullName":"Jane"}}}`
+				if body != want {
+					tt.Errorf("expected body %s, got %s", want, body)
+				}
+			},
+		},
+		{
+			name:     "query generated from the schema",
+			method:   http.MethodPost,
+			body:     `{"query": "{ search(term: \"foo\") { ... on Node { id } ... on User { email role } ... on Post { title } __typename } }"}`,
+			wantCode: http.StatusOK,
+			validate: func(tt *testing.T, body string) {
+				var resp struct {
+					Data struct {
+						Search []map[string]interface{} `json:"search"`
+					} `json:"data"`
+				}
+				if err := json.Unmarshal([]byte(body), &resp); err != nil {
+					tt.Fatal(err)
+				}
+				if len(resp.Data.Search) == 0 {
+					tt.Fatalf("expected search results, got %s", body)
+				}
+				for _, result := range resp.Data.Search {
+					switch result["__typename"] {
+					case "User":
+						if email, _ := result["email"].(string); !strings.Contains(email, "@") {
+							tt.Errorf("expected a generated email, got %v", result)
+						}
+						if result["role"] != "ADMIN" && result["role"] != "USER" {
+							tt.Errorf("expected a generated role, got %v", result)
+						}
+					case "Post":
+						if _, ok := result["title"].(string); !ok {
+							tt.Errorf("expected a generated title, got %v", result)
+						}
+					default:
+						tt.Errorf("unexpected result %v", result)
+					}
+				}
+			},
+		},
+		{
+			name:     "mutation with a templated fixture",
+			method:   http.MethodPost,
+			body:     `{"query": "mutation { createUser(name: \"John\") { name role } }"}`,
+			wantCode: http.StatusOK,
+			validate: func(tt *testing.T, body string) {
+				want := `{"data":{"createUser":{"name":"John","role":"USER"}}}`
+				if body != want {
+					tt.Errorf("expected body %s, got %s", want, body)
+				}
+			},
+		},
+		{
+			name:     "mutation via GET",
+			method:   http.MethodGet,
+			query:    `?query=mutation+{+createUser(name:+"John")+{+name+}+}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid query",
+			method:   http.MethodPost,
+			body:     `{"query": "{ user(id: 1) { password } }"}`,
+			wantCode: http.StatusBadRequest,
+			validate: func(tt *testing.T, body string) {
+				if !strings.Contains(body, `Cannot query field \"password\" on type \"User\"`) {
+					tt.Errorf("expected a validation error, got %s", body)
+				}
+			},
+		},
+		{
+			name:     "body larger than its limit",
+			method:   http.MethodPost,
+			body:     `{"query": "{ user(id: 1) { name } }", "operationName": "` + strings.Repeat("x", int(maxBodySize)) + `"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "failure injection",
+			method:   http.MethodPost,
+			body:     `{"query": "{ user(id: 1) { name } }"}`,
+			ratio:    0.5,
+			wantCode: http.StatusOK,
+			validate: func(tt *testing.T, body string) {
+				want := `{"data":null,"errors":[{"message":"user service unavailable","extensions":{"code":"UNAVAILABLE"}}]}`
+				if body != want {
+					tt.Errorf("expected body %s, got %s", want, body)
+				}
+			},
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{
+				Path: "/graphql",
+				GraphQL: &graphQL{
+					Schema: testGraphQLSchema,
+					Fixtures: map[string]json.RawMessage{
+						"Query.user":          json.RawMessage(`{"id": "42", "name": "Jane", "role": "ADMIN"}`),
+						"Mutation.createUser": json.RawMessage(`"{\"name\": {{json .Args.name}}, \"role\": \"USER\"}"`),
+					},
+					Errors: []json.RawMessage{json.RawMessage(`{"message": "user service unavailable", "extensions": {"code": "UNAVAILABLE"}}`)},
+				},
+			}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			ratio := 1.0
+			if test.ratio != 0 {
+				ratio = test.ratio
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					successRatio: ratio,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			req := httptest.NewRequest(test.method, "/v1/mock/graphql"+test.query, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d (%s)", test.wantCode, w.Code, w.Body.String())
+			}
+			if test.validate != nil {
+				test.validate(tt, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+func Test_graphQL_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gql     graphQL
+		wantErr bool
+	}{
+		{
+			name: "valid definition",
+			gql:  graphQL{Schema: testGraphQLSchema, Fixtures: map[string]json.RawMessage{"User.name": json.RawMessage(`"Jane"`)}},
+		},
+		{
+			name:    "missing schema",
+			gql:     graphQL{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid schema",
+			gql:     graphQL{Schema: `type Query { user: Unknown }`},
+			wantErr: true,
+		},
+		{
+			name:    "unknown fixture field",
+			gql:     graphQL{Schema: testGraphQLSchema, Fixtures: map[string]json.RawMessage{"User.password": json.RawMessage(`"secret"`)}},
+			wantErr: true,
+		},
+		{
+			name:    "error without message",
+			gql:     graphQL{Schema: testGraphQLSchema, Errors: []json.RawMessage{json.RawMessage(`{"code": 1}`)}},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if err := test.gql.validate(); (err != nil) != test.wantErr {
+				tt.Errorf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// defaultGRPCFailure is the status returned by failed gRPC requests unless configured
+var defaultGRPCFailure = &grpcFailure{Code: codes.Unavailable, Message: "failed request"}
+
+// grpcMethod is the definition of a mocked gRPC method
+type grpcMethod struct {
+	Response json.RawMessage               `json:"response"` // response message in the protobuf JSON mapping (empty message if not set)
+	Failure  *grpcFailure                  `json:"failure"`  // status returned by failed requests
+	desc     protoreflect.MethodDescriptor // method descriptor
+	template []byte                        // response template (if any)
+}
+
+// grpcFailure is the status returned by failed gRPC requests
+type grpcFailure struct {
+	Code     codes.Code        `json:"code"`     // status code, either its name (e.g. "UNAVAILABLE") or number
+	Message  string            `json:"message"`  // status message
+	Trailers map[string]string `json:"trailers"` // trailers sent along with the status
+}
+
+// grpcServices are the mocked gRPC services
+type grpcServices struct {
+	files   *protoregistry.Files   // protobuf descriptors of the services
+	methods map[string]*grpcMethod // unary methods by full name (e.g. "/pkg.Service/Method")
+}
+
+// loadGRPCServices loads the services defined in FileDescriptorSet files (built
+// with --include_imports) and .proto files, which are compiled on the fly
+func loadGRPCServices(paths []string) (*grpcServices, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	add := func(fd *descriptorpb.FileDescriptorProto) {
+		if !seen[fd.GetName()] {
+			seen[fd.GetName()] = true
+			set.File = append(set.File, fd)
+		}
+	}
+
+	var protoFiles, importPaths []string
+	for _, p := range paths {
+		if filepath.Ext(p) == ".proto" {
+			protoFiles = append(protoFiles, filepath.Base(p))
+			importPaths = append(importPaths, filepath.Dir(p))
+			continue
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		fds := &descriptorpb.FileDescriptorSet{}
+		if err = proto.Unmarshal(data, fds); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %s: %w", p, err)
+		}
+		for _, fd := range fds.File {
+			add(fd)
+		}
+	}
+
+	if len(protoFiles) > 0 {
+		compiler := protocompile.Compiler{
+			Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+		}
+		files, err := compiler.Compile(context.Background(), protoFiles...)
+		if err != nil {
+			return nil, err
+		}
+		// imported files go first, as files are built in order
+		var addFile func(f protoreflect.FileDescriptor)
+		addFile = func(f protoreflect.FileDescriptor) {
+			for i := 0; i < f.Imports().Len(); i++ {
+				addFile(f.Imports().Get(i).FileDescriptor)
+			}
+			add(protodesc.ToFileDescriptorProto(f))
+		}
+		for _, f := range files {
+			addFile(f)
+		}
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &grpcServices{files: files, methods: map[string]*grpcMethod{}}
+	files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		for i := 0; i < f.Services().Len(); i++ {
+			service := f.Services().Get(i)
+			for j := 0; j < service.Methods().Len(); j++ {
+				desc := service.Methods().Get(j)
+				if !desc.IsStreamingClient() && !desc.IsStreamingServer() {
+					s.methods[fullMethodName(desc)] = &grpcMethod{desc: desc}
+				}
+			}
+		}
+		return true
+	})
+	if len(s.methods) == 0 {
+		return nil, errors.New("no unary methods defined")
+	}
+
+	return s, nil
+}
+
+// loadMethods loads the definitions of the mocked methods from a JSON file, keyed by
+// their full name (e.g. "pkg.Service/Method"). Other methods reply with empty messages.
+func (s *grpcServices) loadMethods(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var definitions map[string]*grpcMethod
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&definitions); err != nil {
+		return fmt.Errorf("invalid json format: %w", err)
+	}
+
+	for name, def := range definitions {
+		m := s.methods["/"+strings.TrimPrefix(name, "/")]
+		if m == nil {
+			return fmt.Errorf("method %s: not found in the descriptors (streaming methods are not supported)", name)
+		}
+		if def == nil {
+			continue
+		}
+		def.desc = m.desc
+		if err = def.validate(); err != nil {
+			return fmt.Errorf("method %s: %w", name, err)
+		}
+		s.methods[fullMethodName(def.desc)] = def
+	}
+
+	return nil
+}
+
+// fullMethodName returns the name of a method as sent by gRPC clients
+func fullMethodName(desc protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", desc.Parent().FullName(), desc.Name())
+}
+
+// validate checks the method definition, preparing its response template (if any)
+func (m *grpcMethod) validate() error {
+	if len(m.Response) > 0 {
+		response, err := parseJSONTemplate(m.Response)
+		if err != nil {
+			return fmt.Errorf("response: %w", err)
+		}
+		if isTemplate(response) {
+			m.template = response
+		} else if err = protojson.Unmarshal(response, dynamicpb.NewMessage(m.desc.Output())); err != nil {
+			return fmt.Errorf("response: %w", err)
+		}
+	}
+
+	if m.Failure != nil {
+		if m.Failure.Code == codes.OK {
+			return errors.New("failure code can't be OK")
+		}
+		for key := range m.Failure.Trailers {
+			if key == "" || key != strings.ToLower(key) || strings.HasPrefix(key, "grpc-") {
+				return fmt.Errorf("invalid failure trailer %q", key)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newGRPCServer returns a gRPC server mocking the methods of the service, along
+// with the reflection service so clients can discover them (e.g. grpcurl)
+func (svc *service) newGRPCServer() *grpc.Server {
+	limiter := rate.NewLimiter(rate.Limit(svc.cfg.rateLimit), svc.cfg.rateLimit)
+	server := grpc.NewServer(
+		grpc.UnknownServiceHandler(svc.handleGRPC),
+		grpc.ChainStreamInterceptor(
+			svc.grpcLogger,
+			svc.grpcRateLimiter(limiter),
+			svc.grpcMocker,
+		),
+	)
+
+	opts := reflection.ServerOptions{Services: svc.cfg.grpcServices, DescriptorResolver: svc.cfg.grpcServices.files}
+	reflectionv1.RegisterServerReflectionServer(server, reflection.NewServerV1(opts))
+	reflectionv1alpha.RegisterServerReflectionServer(server, reflection.NewServer(opts))
+
+	return server
+}
+
+// GetServiceInfo returns the mocked services and their methods, listed by the reflection service
+func (s *grpcServices) GetServiceInfo() map[string]grpc.ServiceInfo {
+	services := map[string]grpc.ServiceInfo{}
+	for _, m := range s.methods {
+		name := string(m.desc.Parent().FullName())
+		info := services[name]
+		info.Methods = append(info.Methods, grpc.MethodInfo{Name: string(m.desc.Name())})
+		info.Metadata = m.desc.ParentFile().Path()
+		services[name] = info
+	}
+
+	return services
+}
+
+// grpcLogger implements a simple interceptor for logging gRPC requests
+func (svc *service) grpcLogger(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	from := "unknown"
+	if p, ok := peer.FromContext(ss.Context()); ok {
+		from = p.Addr.String()
+	}
+	svc.logger.Debug(fmt.Sprintf("gRPC %s from %s", info.FullMethod, from))
+
+	return handler(srv, ss)
+}
+
+// grpcRateLimiter returns an interceptor rejecting the requests to mocked methods exceeding the rate limit
+func (svc *service) grpcRateLimiter(limiter *rate.Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if svc.cfg.grpcServices.methods[info.FullMethod] != nil && !limiter.Allow() {
+			svc.logGRPCFailure(info.FullMethod, "rate limit exceeded", nil)
+			return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// grpcMocker implements an interceptor mocking the requests to mocked methods as any other
+// request, counting them and mocking their delay and failures, which are returned as the
+// method's failure status and trailers
+func (svc *service) grpcMocker(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	m := svc.cfg.grpcServices.methods[info.FullMethod]
+	if m == nil {
+		return handler(srv, ss)
+	}
+
+	if svc.cfg.respDelay > 0 {
+		time.Sleep(svc.cfg.respDelay)
+	}
+	svc.mu.Lock()
+	svc.reqCounter++
+	fail := shouldFail(svc.cfg.successRatio, svc.reqCounter)
+	svc.mu.Unlock()
+
+	if fail {
+		failure := m.Failure
+		if failure == nil {
+			failure = defaultGRPCFailure
+		}
+		if len(failure.Trailers) > 0 {
+			ss.SetTrailer(metadata.New(failure.Trailers))
+		}
+		return status.Error(failure.Code, failure.Message)
+	}
+
+	return handler(srv, ss)
+}
+
+// handleGRPC handles the requests to the mocked methods, replying with their response
+func (svc *service) handleGRPC(_ any, ss grpc.ServerStream) error {
+	fullMethod, _ := grpc.MethodFromServerStream(ss)
+	m := svc.cfg.grpcServices.methods[fullMethod]
+	if m == nil {
+		svc.logGRPCFailure(fullMethod, "[handleGRPC] unknown method", nil)
+		return status.Errorf(codes.Unimplemented, "unknown method %s", fullMethod)
+	}
+
+	req := dynamicpb.NewMessage(m.desc.Input())
+	if err := ss.RecvMsg(req); err != nil {
+		return err
+	}
+
+	resp := dynamicpb.NewMessage(m.desc.Output())
+	body := []byte(m.Response)
+	if m.template != nil {
+		var err error
+		if body, err = svc.renderTemplate(m.template, grpcTemplateData(ss.Context(), fullMethod, req)); err != nil {
+			logID := svc.logGRPCFailure(fullMethod, fmt.Sprintf("[handleGRPC] template rendering error: %+v", err), err)
+			return status.Errorf(codes.Internal, "template rendering error (id: %s)", logID)
+		}
+	}
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, resp); err != nil {
+			logID := svc.logGRPCFailure(fullMethod, fmt.Sprintf("[handleGRPC] invalid response message: %+v", err), err)
+			return status.Errorf(codes.Internal, "invalid response message (id: %s)", logID)
+		}
+	}
+
+	return ss.SendMsg(resp)
+}
+
+// grpcTemplateData returns the template data for a gRPC request, with the request
+// metadata as headers and the request message fields (proto names) as arguments
+func grpcTemplateData(ctx context.Context, fullMethod string, req proto.Message) templateData {
+	headers := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+
+	var args map[string]interface{}
+	if data, err := (protojson.MarshalOptions{UseProtoNames: true}).Marshal(req); err == nil {
+		_ = json.Unmarshal(data, &args)
+	}
+
+	return templateData{
+		Method:  http.MethodPost,
+		Proto:   "HTTP/2.0",
+		Path:    fullMethod,
+		Headers: headers,
+		Args:    args,
+	}
+}
+
+// logGRPCFailure logs gRPC request failures with attached log tracking id
+func (svc *service) logGRPCFailure(fullMethod, msg string, err error) string {
+	id := strconv.FormatUint(rand.Uint64(), 16)
+	message := fmt.Sprintf("[%s] gRPC %s: %s", id, fullMethod, msg)
+	if err != nil {
+		svc.logger.Error(message, "error", err)
+	} else {
+		svc.logger.Warn(message)
+	}
+
+	return id
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const greeterProto = `syntax = "proto3";
+
+package mock.v1;
+
+import "google/protobuf/timestamp.proto";
+
+service Greeter {
+  rpc SayHello(HelloRequest) returns (HelloReply);
+  rpc SayBye(HelloRequest) returns (HelloReply);
+  rpc Chat(stream HelloRequest) returns (stream HelloReply);
+}
+
+message HelloRequest {
+  string name = 1;
+}
+
+message HelloReply {
+  string message = 1;
+  int32 count = 2;
+  google.protobuf.Timestamp sent_at = 3;
+}
+`
+
+// writeGreeterProto writes the greeter .proto file in a temporary directory, returning its path
+func writeGreeterProto(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "greeter.proto")
+	if err := os.WriteFile(path, []byte(greeterProto), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func Test_loadGRPCServices(t *testing.T) {
+	protoFile := writeGreeterProto(t)
+	services, err := loadGRPCServices([]string{protoFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// descriptor set with the same files
+	set := &descriptorpb.FileDescriptorSet{}
+	services.files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(f))
+		return true
+	})
+	data, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptorSet := filepath.Join(t.TempDir(), "greeter.binpb")
+	if err = os.WriteFile(descriptorSet, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.binpb")
+	if err = os.WriteFile(invalid, []byte("not a descriptor set"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  ".proto file",
+			paths: []string{protoFile},
+			want:  []string{"/mock.v1.Greeter/SayHello", "/mock.v1.Greeter/SayBye"},
+		},
+		{
+			name:  "descriptor set",
+			paths: []string{descriptorSet},
+			want:  []string{"/mock.v1.Greeter/SayHello", "/mock.v1.Greeter/SayBye"},
+		},
+		{
+			name:    "invalid descriptor set",
+			paths:   []string{invalid},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			paths:   []string{filepath.Join(t.TempDir(), "missing.proto")},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			got, err := loadGRPCServices(test.paths)
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("loadGRPCServices() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if len(got.methods) != len(test.want) {
+				tt.Errorf("loadGRPCServices() returned %d methods, want %d", len(got.methods), len(test.want))
+			}
+			for _, method := range test.want {
+				if got.methods[method] == nil {
+					tt.Errorf("method %s not found", method)
+				}
+			}
+		})
+	}
+}
+
+func Test_grpcServices_loadMethods(t *testing.T) {
+	protoFile := writeGreeterProto(t)
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid methods",
+			content: `{
+				"mock.v1.Greeter/SayHello": {"response": {"message": "Hello {{.Args.name}}", "count": 1}},
+				"/mock.v1.Greeter/SayBye": {"failure": {"code": "NOT_FOUND", "message": "no one to say bye to", "trailers": {"retry-after": "1"}}}
+			}`,
+		},
+		{
+			name:    "unknown method",
+			content: `{"mock.v1.Greeter/SayWhat": {"response": {}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "streaming method",
+			content: `{"mock.v1.Greeter/Chat": {"response": {}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "response not matching the message type",
+			content: `{"mock.v1.Greeter/SayHello": {"response": {"unknown": true}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "OK failure code",
+			content: `{"mock.v1.Greeter/SayHello": {"failure": {"code": "OK"}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid failure code",
+			content: `{"mock.v1.Greeter/SayHello": {"failure": {"code": "NOT_A_CODE"}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "reserved trailer",
+			content: `{"mock.v1.Greeter/SayHello": {"failure": {"code": "INTERNAL", "trailers": {"grpc-status": "0"}}}}`,
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			services, err := loadGRPCServices([]string{protoFile})
+			if err != nil {
+				tt.Fatal(err)
+			}
+			path := filepath.Join(tt.TempDir(), "methods.json")
+			if err = os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				tt.Fatal(err)
+			}
+
+			if err = services.loadMethods(path); (err != nil) != test.wantErr {
+				tt.Errorf("loadMethods() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func Test_grpcServer(t *testing.T) {
+	protoFile := writeGreeterProto(t)
+	methodsFile := filepath.Join(t.TempDir(), "methods.json")
+	methods := `{
+		"mock.v1.Greeter/SayHello": {
+			"response": {"message": "Hello {{.Args.name}}", "count": 3, "sentAt": "2024-01-01T00:00:00Z"},
+			"failure": {"code": "UNAVAILABLE", "message": "greeter down", "trailers": {"retry-after": "1"}}
+		}
+	}`
+	if err := os.WriteFile(methodsFile, []byte(methods), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// newClient serves the mocked gRPC services with the given configuration and returns a client
+	newClient := func(tt *testing.T, successRatio float64, rateLimit int, respDelay time.Duration) *grpc.ClientConn {
+		services, err := loadGRPCServices([]string{protoFile})
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if err = services.loadMethods(methodsFile); err != nil {
+			tt.Fatal(err)
+		}
+		svc := &service{
+			cfg: &config{
+				successRatio: successRatio,
+				rateLimit:    rateLimit,
+				respDelay:    respDelay,
+				grpcServices: services,
+			},
+			reqCounter: 1,
+			logger:     newStructuredLogger(slog.LevelDebug),
+		}
+
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		server := &http.Server{Handler: svc.newGRPCServer(), Protocols: protocols, ReadHeaderTimeout: time.Second}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			tt.Fatal(err)
+		}
+		go func() { _ = server.Serve(listener) }()
+		tt.Cleanup(func() { _ = server.Close() })
+
+		conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			tt.Fatal(err)
+		}
+		tt.Cleanup(func() { _ = conn.Close() })
+
+		return conn
+	}
+
+	services, err := loadGRPCServices([]string{protoFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := services.methods["/mock.v1.Greeter/SayHello"].desc
+	// call invokes a greeter method, returning the reply and the trailers
+	call := func(conn *grpc.ClientConn, method string) (*dynamicpb.Message, metadata.MD, error) {
+		req := dynamicpb.NewMessage(desc.Input())
+		req.Set(desc.Input().Fields().ByName("name"), protoreflect.ValueOfString("John"))
+		resp := dynamicpb.NewMessage(desc.Output())
+		var trailer metadata.MD
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := conn.Invoke(ctx, method, req, resp, grpc.Trailer(&trailer))
+		return resp, trailer, err
+	}
+	fields := desc.Output().Fields()
+
+	t.Run("Mocked response", func(tt *testing.T) {
+		tt.Parallel()
+		resp, _, err := call(newClient(tt, 1.0, 1000, 0), "/mock.v1.Greeter/SayHello")
+		if err != nil {
+			tt.Fatalf("unexpected error: %v", err)
+		}
+		if got := resp.Get(fields.ByName("message")).String(); got != "Hello John" {
+			tt.Errorf("got message %q, want %q", got, "Hello John")
+		}
+		if got := resp.Get(fields.ByName("count")).Int(); got != 3 {
+			tt.Errorf("got count %d, want 3", got)
+		}
+		if !resp.Has(fields.ByName("sent_at")) {
+			tt.Error("sent_at is not set")
+		}
+	})
+
+	t.Run("Empty response", func(tt *testing.T) {
+		tt.Parallel()
+		resp, _, err := call(newClient(tt, 1.0, 1000, 0), "/mock.v1.Greeter/SayBye")
+		if err != nil {
+			tt.Fatalf("unexpected error: %v", err)
+		}
+		if resp.Has(fields.ByName("message")) {
+			tt.Errorf("got message %q, want empty message", resp.Get(fields.ByName("message")).String())
+		}
+	})
+
+	t.Run("Mocked failure", func(tt *testing.T) {
+		tt.Parallel()
+		_, trailer, err := call(newClient(tt, 0.5, 1000, 0), "/mock.v1.Greeter/SayHello")
+		if got := status.Code(err); got != codes.Unavailable {
+			tt.Fatalf("got code %s, want %s", got, codes.Unavailable)
+		}
+		if got := status.Convert(err).Message(); got != "greeter down" {
+			tt.Errorf("got message %q, want %q", got, "greeter down")
+		}
+		if got := trailer.Get("retry-after"); len(got) != 1 || got[0] != "1" {
+			tt.Errorf("got retry-after trailer %v, want [1]", got)
+		}
+	})
+
+	t.Run("Default failure", func(tt *testing.T) {
+		tt.Parallel()
+		_, _, err := call(newClient(tt, 0.5, 1000, 0), "/mock.v1.Greeter/SayBye")
+		if got := status.Code(err); got != codes.Unavailable {
+			tt.Errorf("got code %s, want %s", got, codes.Unavailable)
+		}
+	})
+
+	t.Run("Concurrent delayed calls", func(tt *testing.T) {
+		tt.Parallel()
+		delay := 500 * time.Millisecond
+		conn := newClient(tt, 1.0, 1000, delay)
+		start := time.Now()
+		errs := make(chan error, 2)
+		for range 2 {
+			go func() {
+				_, _, err := call(conn, "/mock.v1.Greeter/SayHello")
+				errs <- err
+			}()
+		}
+		for range 2 {
+			if err := <-errs; err != nil {
+				tt.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed >= 2*delay {
+			tt.Errorf("calls took %s, want them delayed concurrently (less than %s)", elapsed, 2*delay)
+		}
+	})
+
+	t.Run("Rate limit exceeded", func(tt *testing.T) {
+		tt.Parallel()
+		conn := newClient(tt, 1.0, 1, 0)
+		if _, _, err := call(conn, "/mock.v1.Greeter/SayHello"); err != nil {
+			tt.Fatalf("unexpected error: %v", err)
+		}
+		_, _, err := call(conn, "/mock.v1.Greeter/SayHello")
+		if got := status.Code(err); got != codes.ResourceExhausted {
+			tt.Errorf("got code %s, want %s", got, codes.ResourceExhausted)
+		}
+	})
+
+	t.Run("Unknown method", func(tt *testing.T) {
+		tt.Parallel()
+		_, _, err := call(newClient(tt, 1.0, 1000, 0), "/mock.v1.Greeter/Chat")
+		if got := status.Code(err); got != codes.Unimplemented {
+			tt.Errorf("got code %s, want %s", got, codes.Unimplemented)
+		}
+	})
+
+	t.Run("Reflection", func(tt *testing.T) {
+		tt.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stream, err := reflectionv1.NewServerReflectionClient(newClient(tt, 1.0, 1000, 0)).ServerReflectionInfo(ctx)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		req := &reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_ListServices{},
+		}
+		if err = stream.Send(req); err != nil {
+			tt.Fatal(err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			tt.Fatal(err)
+		}
+		services := resp.GetListServicesResponse().GetService()
+		if len(services) != 1 || services[0].GetName() != "mock.v1.Greeter" {
+			tt.Errorf("got services %v, want [mock.v1.Greeter]", services)
+		}
+	})
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInternalError  = -32603
+	rpcServerError    = -32000
+)
+
+// jsonRPC is the definition of a JSON-RPC 2.0 route
+type jsonRPC struct {
+	Methods map[string]*rpcMethod `json:"methods"` // methods by name
+	Failure *rpcError             `json:"failure"` // error returned by failed calls
+}
+
+// rpcMethod is the definition of a JSON-RPC method
+type rpcMethod struct {
+	Result   json.RawMessage `json:"result"` // result of the calls (any JSON value, null if not set)
+	Error    *rpcError       `json:"error"`  // error returned by every call instead of a result
+	template []byte          // result template (if any)
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// rpcRequest is a JSON-RPC request, or a notification if it has no id
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcResponse is a JSON-RPC response
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// validate checks the JSON-RPC route definition, preparing its result templates
+func (rpc *jsonRPC) validate() error {
+	if len(rpc.Methods) == 0 {
+		return errors.New("at least one method is required")
+	}
+
+	for name, m := range rpc.Methods {
+		if name == "" || strings.HasPrefix(name, "rpc.") {
+			return fmt.Errorf("invalid method name %q", name)
+		}
+		if m == nil {
+			rpc.Methods[name] = &rpcMethod{}
+			continue
+		}
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("method %s: %w", name, err)
+		}
+	}
+
+	if rpc.Failure != nil {
+		if err := rpc.Failure.validate(); err != nil {
+			return fmt.Errorf("failure: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the method definition, preparing its result template (if any)
+func (m *rpcMethod) validate() error {
+	if m.Error != nil {
+		if len(m.Result) > 0 {
+			return errors.New("only one of result or error can be set")
+		}
+		return m.Error.validate()
+	}
+
+	result, err := parseJSONTemplate(m.Result)
+	if err != nil {
+		return fmt.Errorf("invalid result: %w", err)
+	}
+	if isTemplate(result) {
+		m.template = result
+	}
+
+	return nil
+}
+
+// validate checks the error object
+func (e *rpcError) validate() error {
+	if e.Message == "" {
+		return errors.New("error message is required")
+	}
+	if len(e.Data) > 0 && !json.Valid(e.Data) {
+		return errors.New("invalid json error data")
+	}
+
+	return nil
+}
+
+// handleJSONRPC mocks the responses of a JSON-RPC route, replying to single and batch
+// calls. Every call in a batch counts as a request, so it may fail independently.
+func (svc *service) handleJSONRPC(w http.ResponseWriter, r *http.Request, rpc *jsonRPC) {
+	body, err := readBody(w, r, maxBodySize)
+	if err != nil {
+		svc.renderBodyReadingError(w, r, "handleJSONRPC", err)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		if resp := svc.callJSONRPC(r, rpc, body); resp != nil {
+			renderJSON(w, r, http.StatusOK, resp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var calls []json.RawMessage
+	if err = json.Unmarshal(body, &calls); err != nil {
+		svc.LogRequestFailure(r, "[handleJSONRPC] invalid batch", err)
+		renderJSON(w, r, http.StatusOK, newRPCError(nil, rpcParseError, "Parse error", nil))
+		return
+	}
+	if len(calls) == 0 {
+		svc.LogRequestFailure(r, "[handleJSONRPC] empty batch", nil)
+		renderJSON(w, r, http.StatusOK, newRPCError(nil, rpcInvalidRequest, "Invalid Request", nil))
+		return
+	}
+
+	responses := make([]*rpcResponse, 0, len(calls))
+	for i, call := range calls {
+		if i > 0 {
+			svc.reqCounter++
+		}
+		if resp := svc.callJSONRPC(r, rpc, call); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		// batches of notifications aren't replied
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	renderJSON(w, r, http.StatusOK, responses)
+}
+
+// callJSONRPC mocks a JSON-RPC call, returning its response or nil for notifications
+func (svc *service) callJSONRPC(r *http.Request, rpc *jsonRPC, call json.RawMessage) *rpcResponse {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(call, &fields); err != nil {
+		if !json.Valid(call) {
+			svc.LogRequestFailure(r, "[callJSONRPC] invalid json", err)
+			return newRPCError(nil, rpcParseError, "Parse error", nil)
+		}
+		svc.LogRequestFailure(r, "[callJSONRPC] invalid request", err)
+		return newRPCError(nil, rpcInvalidRequest, "Invalid Request", nil)
+	}
+
+	req := &rpcRequest{}
+	err := json.Unmarshal(call, req)
+	if err != nil || req.JSONRPC != "2.0" || req.Method == "" || !isValidRPCID(req.ID) || !isValidRPCParams(req.Params) {
+		svc.LogRequestFailure(r, "[callJSONRPC] invalid request", err)
+		id := req.ID
+		if !isValidRPCID(id) {
+			id = nil
+		}
+		return newRPCError(id, rpcInvalidRequest, "Invalid Request", nil)
+	}
+
+	resp := svc.mockRPCCall(r, rpc, req)
+	if _, found := fields["id"]; !found {
+		// notifications are never replied
+		return nil
+	}
+
+	return resp
+}
+
+// mockRPCCall returns the mocked response of a valid JSON-RPC call
+func (svc *service) mockRPCCall(r *http.Request, rpc *jsonRPC, req *rpcRequest) *rpcResponse {
+	m := rpc.Methods[req.Method]
+	if m == nil {
+		svc.LogRequestFailure(r, "[mockRPCCall] method not found: "+req.Method, nil)
+		return newRPCError(req.ID, rpcMethodNotFound, "Method not found", nil)
+	}
+
+	// Return failure based on success ratio and requests counter
+	if shouldFail(svc.cfg.successRatio, svc.reqCounter) {
+		logID := svc.LogRequestFailure(r, "[mockRPCCall] failed request: "+req.Method, nil)
+		if rpc.Failure != nil {
+			return &rpcResponse{JSONRPC: "2.0", Error: rpc.Failure, ID: req.ID}
+		}
+		return newRPCError(req.ID, rpcServerError, "failed request", map[string]interface{}{"code": api.CodeFailedRequest, "id": logID})
+	}
+
+	if m.Error != nil {
+		return &rpcResponse{JSONRPC: "2.0", Error: m.Error, ID: req.ID}
+	}
+
+	result := m.Result
+	if m.template != nil {
+		data := svc.newTemplateData(r)
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &data.Args); err != nil {
+				return newRPCError(req.ID, rpcInternalError, "Internal error", nil)
+			}
+		}
+		rendered, err := svc.renderTemplate(m.template, data)
+		if err == nil && !json.Valid(rendered) {
+			err = errors.New("rendered result is not valid json")
+		}
+		if err != nil {
+			logID := svc.LogRequestFailure(r, fmt.Sprintf("[mockRPCCall] template rendering error: %+v", err), err)
+			return newRPCError(req.ID, rpcInternalError, "Internal error", map[string]interface{}{"code": api.CodeTemplateError, "id": logID})
+		}
+		result = rendered
+	}
+	if len(result) == 0 {
+		result = json.RawMessage("null")
+	}
+
+	return &rpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+// newRPCError returns a JSON-RPC error response for the given request id (null if nil)
+func newRPCError(id json.RawMessage, code int, message string, data interface{}) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	rpcErr := &rpcError{Code: code, Message: message}
+	if data != nil {
+		rpcErr.Data, _ = json.Marshal(data)
+	}
+
+	return &rpcResponse{JSONRPC: "2.0", Error: rpcErr, ID: id}
+}
+
+// isValidRPCID returns true if the request id is a string, a number or null (or not set)
+func isValidRPCID(id json.RawMessage) bool {
+	if len(id) == 0 {
+		return true
+	}
+	var value interface{}
+	if err := json.Unmarshal(id, &value); err != nil {
+		return false
+	}
+	switch value.(type) {
+	case string, float64, nil:
+		return true
+	default:
+		return false
+	}
+}
+
+// isValidRPCParams returns true if the request params are an array or an object (or not set)
+func isValidRPCParams(params json.RawMessage) bool {
+	return len(params) == 0 || params[0] == '[' || params[0] == '{'
+}
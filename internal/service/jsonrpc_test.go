@@ -0,0 +1,214 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_service_handleJSONRPC(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		ratio    float64
+		failure  *rpcError
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "call with a result",
+			body:     `{"jsonrpc": "2.0", "method": "eth_blockNumber", "id": 1}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","result":"0x10","id":1}`,
+		},
+		{
+			name:     "call with a templated result",
+			body:     `{"jsonrpc": "2.0", "method": "eth_getBalance", "params": ["0xabc", "latest"], "id": "req-1"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","result":{"address":"0xabc","block":"latest"},"id":"req-1"}`,
+		},
+		{
+			name:     "call with named params",
+			body:     `{"jsonrpc": "2.0", "method": "textDocument/hover", "params": {"uri": "file:///main.go"}, "id": 2}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","result":{"contents":"file:///main.go"},"id":2}`,
+		},
+		{
+			name:     "call with an error",
+			body:     `{"jsonrpc": "2.0", "method": "eth_call", "id": 3}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":3,"message":"execution reverted","data":"0x08c379a0"},"id":3}`,
+		},
+		{
+			name:     "call with a null result",
+			body:     `{"jsonrpc": "2.0", "method": "shutdown", "id": null}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","result":null,"id":null}`,
+		},
+		{
+			name:     "unknown method",
+			body:     `{"jsonrpc": "2.0", "method": "foo", "id": 4}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":4}`,
+		},
+		{
+			name:     "notification",
+			body:     `{"jsonrpc": "2.0", "method": "eth_blockNumber"}`,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "parse error",
+			body:     `{"jsonrpc": "2.0", "method"`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name:     "invalid request",
+			body:     `{"jsonrpc": "1.0", "method": "eth_blockNumber", "id": 5}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":5}`,
+		},
+		{
+			name:     "invalid params",
+			body:     `{"jsonrpc": "2.0", "method": "eth_blockNumber", "params": "latest", "id": 6}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":6}`,
+		},
+		{
+			name: "batch",
+			body: `[
+				{"jsonrpc": "2.0", "method": "eth_blockNumber", "id": 1},
+				{"jsonrpc": "2.0", "method": "eth_blockNumber"},
+				{"jsonrpc": "2.0", "method": "foo", "id": 2},
+				1
+			]`,
+			wantCode: http.StatusOK,
+			wantBody: `[{"jsonrpc":"2.0","result":"0x10","id":1},{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":2},{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`,
+		},
+		{
+			name:     "batch of notifications",
+			body:     `[{"jsonrpc": "2.0", "method": "eth_blockNumber"}, {"jsonrpc": "2.0", "method": "shutdown"}]`,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "empty batch",
+			body:     `[]`,
+			wantCode: http.StatusOK,
+			wantBody: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name:     "body larger than its limit",
+			body:     `{"jsonrpc": "2.0", "method": "eth_blockNumber", "id": "` + strings.Repeat("x", int(maxBodySize)) + `"}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "batch with failures",
+			body:     `[{"jsonrpc": "2.0", "method": "eth_blockNumber", "id": 1}, {"jsonrpc": "2.0", "method": "eth_blockNumber", "id": 2}]`,
+			ratio:    0.5,
+			failure:  &rpcError{Code: -32005, Message: "limit exceeded"},
+			wantCode: http.StatusOK,
+			wantBody: `[{"jsonrpc":"2.0","error":{"code":-32005,"message":"limit exceeded"},"id":1},{"jsonrpc":"2.0","result":"0x10","id":2}]`,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{
+				Path: "/rpc",
+				JSONRPC: &jsonRPC{
+					Methods: map[string]*rpcMethod{
+						"eth_blockNumber":    {Result: json.RawMessage(`"0x10"`)},
+						"eth_getBalance":     {Result: json.RawMessage(`{"address": "{{index .Args 0}}", "block": "{{index .Args 1}}"}`)},
+						"textDocument/hover": {Result: json.RawMessage(`{"contents": "{{.Args.uri}}"}`)},
+						"eth_call":           {Error: &rpcError{Code: 3, Message: "execution reverted", Data: json.RawMessage(`"0x08c379a0"`)}},
+						"shutdown":           nil,
+					},
+					Failure: test.failure,
+				},
+			}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			ratio := 1.0
+			if test.ratio != 0 {
+				ratio = test.ratio
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					successRatio: ratio,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/mock/rpc", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d (%s)", test.wantCode, w.Code, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); test.wantCode != http.StatusRequestEntityTooLarge && got != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_jsonRPC_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rpc     jsonRPC
+		wantErr bool
+	}{
+		{
+			name: "valid definition",
+			rpc:  jsonRPC{Methods: map[string]*rpcMethod{"eth_blockNumber": {Result: json.RawMessage(`"0x10"`)}}},
+		},
+		{
+			name:    "no methods",
+			rpc:     jsonRPC{},
+			wantErr: true,
+		},
+		{
+			name:    "reserved method name",
+			rpc:     jsonRPC{Methods: map[string]*rpcMethod{"rpc.discover": {}}},
+			wantErr: true,
+		},
+		{
+			name:    "result and error",
+			rpc:     jsonRPC{Methods: map[string]*rpcMethod{"eth_call": {Result: json.RawMessage(`1`), Error: &rpcError{Code: 3, Message: "reverted"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "error without message",
+			rpc:     jsonRPC{Methods: map[string]*rpcMethod{"eth_call": {Error: &rpcError{Code: 3}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid result template",
+			rpc:     jsonRPC{Methods: map[string]*rpcMethod{"eth_call": {Result: json.RawMessage(`"{{.Args"`)}}},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if err := test.rpc.validate(); (err != nil) != test.wantErr {
+				tt.Errorf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -80,6 +80,12 @@ func (svc *service) request(r *http.Request, trackID string) {
 		r.Proto,
 		origin,
 	)
+	if params := pathParams(r); len(params) > 0 {
+		reqInfo = fmt.Sprintf("%s with path params %v", reqInfo, params)
+	}
+	if identity := svc.clientIdentity(r); identity != "" {
+		reqInfo = fmt.Sprintf("%s as %s", reqInfo, identity)
+	}
 	if trackID != "" {
 		reqInfo = fmt.Sprintf("[%s] %s", trackID, reqInfo)
 	}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// defaultLongPollTimeout is the time long-polling requests wait by default
+const defaultLongPollTimeout = 30 * time.Second
+
+// admin routes, served under URI_PREFIX like the mocked routes
+const (
+	adminPathPrefix = "/__admin/"                        // prefix of the admin routes, which can't be mocked
+	eventsPath      = adminPathPrefix + "events/{event}" // route triggering the events answering long-polling requests
+)
+
+// longPoll is the definition of a long-polling route, holding requests until
+// an event is triggered, a scheduled time is reached or they time out
+type longPoll struct {
+	Event       string          `json:"event"`       // event answering the waiting requests
+	At          string          `json:"at"`          // scheduled time answering the waiting requests (RFC 3339 or HH:MM:SS in UTC)
+	Timeout     int             `json:"timeout"`     // time requests wait before timing out (in milliseconds)
+	Body        json.RawMessage `json:"body"`        // response body when answered (any JSON value)
+	TimeoutCode int             `json:"timeoutCode"` // status code of timed out requests (defaults to 204)
+	TimeoutBody json.RawMessage `json:"timeoutBody"` // response body of timed out requests (any JSON value)
+	body        []byte          // response body template
+	timeoutBody []byte          // timed out response body template
+}
+
+// validate checks the long-polling route definition and sets its defaults
+func (lp *longPoll) validate() error {
+	if lp.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+	if lp.Timeout == 0 {
+		lp.Timeout = int(defaultLongPollTimeout / time.Millisecond)
+	}
+	if lp.At != "" {
+		if _, err := lp.scheduledTime(time.Now()); err != nil {
+			return err
+		}
+	}
+	if lp.TimeoutCode == 0 {
+		lp.TimeoutCode = http.StatusNoContent
+	}
+	if lp.TimeoutCode < 100 || lp.TimeoutCode > 599 {
+		return fmt.Errorf("invalid timeout code %d", lp.TimeoutCode)
+	}
+
+	var err error
+	if lp.body, err = parseJSONTemplate(lp.Body); err != nil {
+		return fmt.Errorf("invalid body: %w", err)
+	}
+	if lp.timeoutBody, err = parseJSONTemplate(lp.TimeoutBody); err != nil {
+		return fmt.Errorf("invalid timeout body: %w", err)
+	}
+
+	return nil
+}
+
+// scheduledTime returns the scheduled time answering the requests waiting since now,
+// time of day schedules being the next occurrence of that time
+func (lp *longPoll) scheduledTime(now time.Time) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, lp.At); err == nil {
+		return at, nil
+	}
+	clock, err := time.Parse(time.TimeOnly, lp.At)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid scheduled time %q", lp.At)
+	}
+
+	now = now.UTC()
+	at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+
+	return at, nil
+}
+
+// serveLongPoll returns a handler holding the requests until the route's event is triggered,
+// its scheduled time is reached or they time out, replying then
+func (svc *service) serveLongPoll(lp *longPoll) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var triggered <-chan []byte
+		if lp.Event != "" {
+			ch := svc.events.subscribe(lp.Event)
+			defer svc.events.unsubscribe(lp.Event, ch)
+			triggered = ch
+		}
+		var scheduled <-chan time.Time
+		if lp.At != "" {
+			at, _ := lp.scheduledTime(time.Now())
+			timer := time.NewTimer(time.Until(at))
+			defer timer.Stop()
+			scheduled = timer.C
+		}
+		timeout := time.NewTimer(time.Duration(lp.Timeout) * time.Millisecond)
+		defer timeout.Stop()
+
+		body := lp.body
+		if body == nil {
+			body = svc.cfg.successRespBody
+		}
+		data := svc.newTemplateData(r)
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			svc.renderLongPoll(w, r, lp.TimeoutCode, lp.timeoutBody, data)
+		case <-scheduled:
+			svc.renderLongPoll(w, r, svc.cfg.successCode, body, data)
+		case payload := <-triggered:
+			if lp.body == nil && len(payload) > 0 {
+				// the event payload is replied as is when the route has no body
+				renderJSON(w, r, svc.cfg.successCode, json.RawMessage(payload))
+				return
+			}
+			data.Message = string(payload)
+			svc.renderLongPoll(w, r, svc.cfg.successCode, body, data)
+		}
+	}
+}
+
+// renderLongPoll renders the body template (if any) and writes it with the given status code
+func (svc *service) renderLongPoll(w http.ResponseWriter, r *http.Request, status int, body []byte, data templateData) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	rendered, err := svc.renderTemplate(body, data)
+	if err == nil && !json.Valid(rendered) {
+		err = fmt.Errorf("rendered body is not valid json: %s", rendered)
+	}
+	if err != nil {
+		svc.renderTemplateError(w, r, err)
+		return
+	}
+
+	renderJSON(w, r, status, json.RawMessage(rendered))
+}
+
+// handleEvent triggers an event, answering the long-polling requests waiting for it with
+// the request body (if any) as event payload
+// Route: {prefix}/__admin/events/{event}
+func (svc *service) handleEvent(w http.ResponseWriter, r *http.Request) {
+	payload, err := readBody(w, r, maxBodySize)
+	if err != nil {
+		svc.renderBodyReadingError(w, r, "handleEvent", err)
+		return
+	}
+	if len(payload) > 0 && !json.Valid(payload) {
+		logID := svc.LogRequestFailure(r, "[handleEvent] invalid json payload", nil)
+		renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("body parsing error", api.CodeInvalidBody, logID))
+		return
+	}
+
+	event := chi.URLParam(r, "event")
+	answered := svc.events.publish(event, payload)
+	svc.logger.Debug(fmt.Sprintf("event %s triggered, %d requests answered", event, answered))
+	renderJSON(w, r, http.StatusOK, map[string]interface{}{"event": event, "answered": answered})
+}
+
+// eventHub dispatches the triggered events to the requests waiting for them
+type eventHub struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan []byte]struct{}
+}
+
+// subscribe returns a channel receiving the payload of the next triggered event
+func (h *eventHub) subscribe(event string) chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.waiters == nil {
+		h.waiters = map[string]map[chan []byte]struct{}{}
+	}
+	if h.waiters[event] == nil {
+		h.waiters[event] = map[chan []byte]struct{}{}
+	}
+	ch := make(chan []byte, 1)
+	h.waiters[event][ch] = struct{}{}
+
+	return ch
+}
+
+// unsubscribe stops waiting for an event
+func (h *eventHub) unsubscribe(event string, ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.waiters[event], ch)
+	if len(h.waiters[event]) == 0 {
+		delete(h.waiters, event)
+	}
+}
+
+// publish sends the event payload to the requests waiting for it, returning how many of them were waiting
+func (h *eventHub) publish(event string, payload []byte) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	waiters := h.waiters[event]
+	for ch := range waiters {
+		ch <- payload
+	}
+	delete(h.waiters, event)
+
+	return len(waiters)
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_service_serveLongPoll(t *testing.T) {
+	tests := []struct {
+		name     string
+		lp       longPoll
+		trigger  bool
+		event    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "answered by an event with the route body",
+			lp:       longPoll{Event: "new-message", Body: json.RawMessage(`{"messages": [{{.Message}}], "channel": "{{.Params.channel}}"}`)},
+			trigger:  true,
+			event:    `{"text": "hi"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"messages":[{"text":"hi"}],"channel":"general"}`,
+		},
+		{
+			name:     "answered by an event with its payload",
+			lp:       longPoll{Event: "new-message"},
+			trigger:  true,
+			event:    `{"text": "hi"}`,
+			wantCode: http.StatusOK,
+			wantBody: `{"text":"hi"}`,
+		},
+		{
+			name:     "answered by an event without payload",
+			lp:       longPoll{Event: "new-message"},
+			trigger:  true,
+			wantCode: http.StatusOK,
+			wantBody: `{"success":true}`,
+		},
+		{
+			name:     "answered at the scheduled time",
+			lp:       longPoll{At: time.Now().Add(100 * time.Millisecond).UTC().Format(time.RFC3339Nano), Body: json.RawMessage(`{"status": "done"}`)},
+			wantCode: http.StatusOK,
+			wantBody: `{"status":"done"}`,
+		},
+		{
+			name:     "timed out",
+			lp:       longPoll{Event: "new-message", Timeout: 50},
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "timed out with a body",
+			lp:       longPoll{Timeout: 50, TimeoutCode: http.StatusRequestTimeout, TimeoutBody: json.RawMessage(`{"messages": []}`)},
+			wantCode: http.StatusRequestTimeout,
+			wantBody: `{"messages":[]}`,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{Path: "/channels/{channel}/poll", LongPoll: &test.lp}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					successRatio:    1,
+					successCode:     http.StatusOK,
+					successRespBody: defaultSuccessRespBody,
+					rateLimit:       1000,
+					routes:          []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			w := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/mock/channels/general/poll", nil))
+			}()
+
+			if test.trigger {
+				waitForWaiters(tt, &svc.events, test.lp.Event)
+				ew := httptest.NewRecorder()
+				svc.router.ServeHTTP(ew, httptest.NewRequest(http.MethodPost, "/v1/mock/__admin/events/"+test.lp.Event, strings.NewReader(test.event)))
+				if want := `{"answered":1,"event":"new-message"}`; strings.TrimSpace(ew.Body.String()) != want {
+					tt.Errorf("expected event response %s, got %s", want, ew.Body.String())
+				}
+			}
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				tt.Fatal("request not answered")
+			}
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d (%s)", test.wantCode, w.Code, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, got)
+			}
+		})
+	}
+}
+
+// waitForWaiters waits until some request is waiting for the event
+func waitForWaiters(t *testing.T, h *eventHub, event string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		h.mu.Lock()
+		waiting := len(h.waiters[event])
+		h.mu.Unlock()
+		if waiting > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no request waiting for event %s", event)
+}
+
+func Test_longPoll_scheduledTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		at      string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "timestamp",
+			at:   "2024-05-02T08:30:00Z",
+			want: time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "time of day later today",
+			at:   "12:00:00",
+			want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "time of day tomorrow",
+			at:   "10:00:00",
+			want: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "invalid time",
+			at:      "tomorrow",
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			lp := &longPoll{At: test.at}
+			got, err := lp.scheduledTime(now)
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("scheduledTime() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !got.Equal(test.want) {
+				tt.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_service_handleEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		apiKey   string
+		wantCode int
+	}{
+		{
+			name:     "authenticated event",
+			path:     "/v1/mock/__admin/events/new-message",
+			apiKey:   "some-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "unauthenticated event",
+			path:     "/v1/mock/__admin/events/new-message",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "event payload larger than its limit",
+			path:     "/v1/mock/__admin/events/new-message",
+			body:     `{"text": "` + strings.Repeat("x", int(maxBodySize)) + `"}`,
+			apiKey:   "some-key",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "event outside the URI prefix",
+			path:     "/__admin/events/new-message",
+			apiKey:   "some-key",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					apiKeys:      []string{"some-key"},
+					successRatio: 1,
+					successCode:  http.StatusOK,
+					rateLimit:    1000,
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			body := test.body
+			if body == "" {
+				body = `{"text": "hi"}`
+			}
+			req := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(body))
+			if test.apiKey != "" {
+				req.Header.Set("X-API-KEY", test.apiKey)
+			}
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d (%s)", test.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
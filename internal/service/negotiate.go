@@ -0,0 +1,90 @@
+package service
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is a media range parsed from an Accept header
+type mediaRange struct {
+	mainType, subType string
+	quality           float64
+}
+
+// parseAccept parses the media ranges of an Accept header,
+// ignoring malformed ones
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		mainType, subType, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := params["q"]; found {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mainType: mainType, subType: subType, quality: quality})
+	}
+
+	return ranges
+}
+
+// specificity returns how specifically the media range matches the given
+// media type (3 for an exact match, 2 for type/*, 1 for */*) or 0 if it doesn't match
+func (mr mediaRange) specificity(mainType, subType string) int {
+	switch {
+	case mr.mainType == "*" && mr.subType == "*":
+		return 1
+	case mr.mainType == mainType && mr.subType == "*":
+		return 2
+	case mr.mainType == mainType && mr.subType == subType:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// negotiateContentType returns the index of the offered content type that best
+// matches the given Accept header, or -1 if none is acceptable. An empty Accept
+// header accepts any content type. Ties are resolved in favor of the first offer.
+func negotiateContentType(accept string, offers []string) int {
+	if len(offers) == 0 {
+		return -1
+	}
+	if strings.TrimSpace(accept) == "" {
+		return 0
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQuality := -1, 0.0
+	for i, offer := range offers {
+		mediaType, _, err := mime.ParseMediaType(offer)
+		if err != nil {
+			continue
+		}
+		mainType, subType, _ := strings.Cut(mediaType, "/")
+
+		// The most specific matching range determines the offer quality
+		quality, specificity := 0.0, 0
+		for _, mr := range ranges {
+			if s := mr.specificity(mainType, subType); s > specificity {
+				quality, specificity = mr.quality, s
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = i, quality
+		}
+	}
+
+	return best
+}
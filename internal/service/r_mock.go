@@ -2,112 +2,201 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
-	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/render"
 
 	"github.com/juan131/api-mock/pkg/api"
+	"github.com/juan131/api-mock/pkg/schema"
 )
 
-// incReqCounter implements a simple middleware handler for
-// increasing a request counter on every request
-func (svc *service) incReqCounter() func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			svc.mu.Lock()
-			defer svc.mu.Unlock()
-			svc.reqCounter++
-			next.ServeHTTP(w, r)
-		})
+// maxBodySize is the maximum size of the request bodies read by the mock (1 MiB)
+const maxBodySize int64 = 1 << 20
+
+// incReqCounter returns a handler delaying the request and then increasing the request counter,
+// serving the request while holding the service lock. The delay is applied before taking the lock,
+// so concurrent requests (e.g. the requests of a batch request) are delayed concurrently.
+func (svc *service) incReqCounter(delay time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Delay response
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		svc.reqCounter++
+		next(w, r)
 	}
 }
 
 // handleMock mocks request handling
 // Route: /v1/mock/*
 func (svc *service) handleMock(w http.ResponseWriter, r *http.Request) {
-	// Delay response
-	if svc.cfg.respDelay > 0 {
-		time.Sleep(svc.cfg.respDelay)
-	}
+	svc.mockResponse(w, r, svc.renderSuccess, svc.renderFailure)
+}
 
-	// Return failure based on success ratio and requests counter
-	if shouldFail(svc.cfg.successRatio, svc.reqCounter) {
-		render.Status(r, svc.cfg.failureCode)
-		if svc.cfg.failureRespBody != nil {
-			render.JSON(w, r, svc.cfg.failureRespBody)
-		} else {
-			render.JSON(w, r, api.MakeHTTPErrorResponse("failed request", api.CodeFailedRequest, strconv.FormatUint(rand.Uint64(), 16)))
+// handleRoute returns a handler mocking the responses of a route defined in the routes file
+// Route: /v1/mock/<route path>
+func (svc *service) handleRoute(rt *route) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case rt.GraphQL != nil:
+			svc.handleGraphQL(w, r, rt.GraphQL)
+		case rt.JSONRPC != nil:
+			svc.handleJSONRPC(w, r, rt.JSONRPC)
+		case rt.SOAP != nil:
+			svc.handleSOAP(w, r, rt.SOAP)
+		case rt.Job != nil:
+			svc.handleJobSubmission(w, r, rt.Job)
+		case rt.Schema != nil:
+			svc.mockResponse(w, r, svc.renderSchema(rt), svc.renderFailure)
+		case len(rt.Representations) > 0:
+			w.Header().Add("Vary", "Accept")
+			rep := rt.negotiate(r.Header.Get("Accept"))
+			if rep == nil {
+				logID := svc.LogRequestFailure(r, "[handleRoute] no acceptable representation for "+r.Header.Get("Accept"), nil)
+				renderJSON(w, r, http.StatusNotAcceptable, api.MakeHTTPErrorResponse("not acceptable", api.CodeNotAcceptable, logID))
+				return
+			}
+			svc.mockResponse(w, r, svc.renderRepresentation(rep), svc.renderFailure)
+		default:
+			svc.mockResponse(w, r, svc.renderSuccess, svc.renderFailure)
 		}
-		return
+	}
+	if len(rt.Webhooks) > 0 {
+		return svc.withWebhooks(rt.Webhooks, handler)
 	}
 
-	render.Status(r, svc.cfg.successCode)
-	render.JSON(w, r, svc.cfg.successRespBody)
+	return handler
 }
 
-// handleBatchMock mocks batch request handling
-// Route: /v1/mock/batch
-func (svc *service) handleBatchMock(w http.ResponseWriter, r *http.Request) {
-	var requests []api.SingleRequest
-
-	encodedBody, err := io.ReadAll(r.Body)
-	if err != nil {
-		logID := svc.LogRequestFailure(r, fmt.Sprintf("[handleBatchMock] body reading error: %+v", err), err)
-		renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("body parsing error", api.CodeInvalidBody, logID))
-		return
+// handleStream returns a handler mocking a streaming route defined in the routes file
+// Route: /v1/mock/<route path>
+func (svc *service) handleStream(rt *route) http.HandlerFunc {
+	if rt.SSE != nil {
+		return svc.mockStream(svc.routeDelay(rt), svc.serveSSE(rt.SSE))
+	}
+	if rt.LongPoll != nil {
+		return svc.mockStream(svc.routeDelay(rt), svc.serveLongPoll(rt.LongPoll))
 	}
 
-	decodedBody, err := url.ParseQuery(string(encodedBody))
-	if err != nil {
-		logID := svc.LogRequestFailure(r, fmt.Sprintf("[handleBatchMock] body reading error: %+v", err), err)
-		renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("body parsing error", api.CodeInvalidBody, logID))
-		return
+	return svc.mockStream(svc.routeDelay(rt), svc.serveWebSocket(rt.WebSocket))
+}
+
+// mockStream mocks the request opening a stream as any other request, counting it and mocking
+// its delay and failures, then serves the stream without holding the service lock, so other
+// requests are served meanwhile
+func (svc *service) mockStream(delay time.Duration, stream http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isBatchRequest(r) {
+			logID := svc.LogRequestFailure(r, "[mockStream] streaming routes can't be batched", nil)
+			renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("streaming routes can't be batched", api.CodeInvalidBody, logID))
+			return
+		}
+
+		// Delay response
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+
+		succeeded := false
+		svc.mu.Lock()
+		svc.reqCounter++
+		svc.mockResponse(w, r, func(http.ResponseWriter, *http.Request) { succeeded = true }, svc.renderFailure)
+		svc.mu.Unlock()
+
+		if succeeded {
+			stream(w, r)
+		}
 	}
+}
 
-	if err := json.Unmarshal([]byte(decodedBody.Get("batch")), &requests); err != nil {
-		logID := svc.LogRequestFailure(r, fmt.Sprintf("[handleBatchMock] body reading error: %+v", err), err)
-		renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("body parsing error", api.CodeInvalidBody, logID))
+// mockResponse writes a mocked response, calling the success handler
+// to reply unless the request should fail, calling the failure one then
+func (svc *service) mockResponse(w http.ResponseWriter, r *http.Request, success, failure http.HandlerFunc) {
+	// Return failure based on success ratio and requests counter
+	if shouldFail(svc.cfg.successRatio, svc.reqCounter) {
+		failure(w, r)
 		return
 	}
 
-	responses := make([]api.BatchResponse, 0, len(requests))
-	for _, r := range requests {
-		svc.logger.Info(fmt.Sprintf("Individual request: %v", r))
-		if shouldFail(svc.cfg.successRatio, svc.reqCounter) {
-			var body []byte
-			if svc.cfg.failureRespBody != nil {
-				body, err = json.Marshal(svc.cfg.failureRespBody)
+	success(w, r)
+}
+
+// renderSuccess writes the configured success response
+func (svc *service) renderSuccess(w http.ResponseWriter, r *http.Request) {
+	svc.renderMockJSON(w, r, svc.cfg.successCode, svc.cfg.successRespBody)
+}
+
+// renderRepresentation returns a handler writing the given representation as success response
+func (svc *service) renderRepresentation(rep *representation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payload := rep.payload
+		if !rep.Base64 {
+			var err error
+			if isJSONMediaType(rep.mediaType()) {
+				payload, err = svc.renderJSONBody(r, payload)
 			} else {
-				body, err = json.Marshal(api.MakeHTTPErrorResponse("failed request", api.CodeFailedRequest, strconv.FormatUint(rand.Uint64(), 16)))
-			}
-			if err != nil {
-				continue
+				payload, err = svc.renderBody(r, payload)
 			}
-			responses = append(responses, api.BatchResponse{
-				Code: svc.cfg.failureCode,
-				Body: string(body),
-			})
-		} else {
-			body, err := json.Marshal(svc.cfg.successRespBody)
 			if err != nil {
-				continue
+				svc.renderTemplateError(w, r, err)
+				return
 			}
-			responses = append(responses, api.BatchResponse{
-				Code: svc.cfg.successCode,
-				Body: string(body),
-			})
 		}
-		svc.reqCounter++
+
+		w.Header().Set("Content-Type", rep.ContentType)
+		w.WriteHeader(svc.cfg.successCode)
+		_, _ = w.Write(payload)
+	}
+}
+
+// renderSchema returns a handler writing a random document conforming
+// to the route's JSON Schema as success response
+func (svc *service) renderSchema(rt *route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc, err := schema.NewGenerator(rt.Schema, svc.fakeGenerator()).Generate()
+		if err != nil {
+			logID := svc.LogRequestFailure(r, fmt.Sprintf("[renderSchema] document generation error: %+v", err), err)
+			renderJSON(w, r, http.StatusInternalServerError, api.MakeHTTPErrorResponse("schema generation error", api.CodeSchemaError, logID))
+			return
+		}
+
+		renderJSON(w, r, svc.cfg.successCode, doc)
+	}
+}
+
+// renderFailure writes a mocked failure response
+func (svc *service) renderFailure(w http.ResponseWriter, r *http.Request) {
+	if svc.cfg.failureRespBody != nil {
+		svc.renderMockJSON(w, r, svc.cfg.failureCode, svc.cfg.failureRespBody)
+	} else {
+		renderJSON(w, r, svc.cfg.failureCode, api.MakeHTTPErrorResponse("failed request", api.CodeFailedRequest, strconv.FormatUint(rand.Uint64(), 16)))
 	}
+}
+
+// renderMockJSON renders a JSON body template (if any) and writes it with the given status code
+func (svc *service) renderMockJSON(w http.ResponseWriter, r *http.Request, status int, body json.RawMessage) {
+	rendered, err := svc.renderJSONBody(r, body)
+	if err != nil {
+		svc.renderTemplateError(w, r, err)
+		return
+	}
+
+	renderJSON(w, r, status, rendered)
+}
 
-	render.Status(r, http.StatusOK)
-	render.JSON(w, r, responses)
+// renderTemplateError handles response body template rendering errors
+func (svc *service) renderTemplateError(w http.ResponseWriter, r *http.Request, err error) {
+	logID := svc.LogRequestFailure(r, fmt.Sprintf("[renderTemplateError] template rendering error: %+v", err), err)
+	renderJSON(w, r, http.StatusInternalServerError, api.MakeHTTPErrorResponse("template rendering error", api.CodeTemplateError, logID))
 }
 
 // handleNotFound handles not found requests
@@ -126,7 +215,7 @@ func (svc *service) handleMethodNotAllowed(w http.ResponseWriter, r *http.Reques
 func (svc *service) handleRateLimitExceeded(w http.ResponseWriter, r *http.Request) {
 	logID := svc.LogRequestFailure(r, "rate limit exceeded", nil)
 	if svc.cfg.rateExceededRespBody != nil {
-		renderJSON(w, r, http.StatusTooManyRequests, svc.cfg.rateExceededRespBody)
+		svc.renderMockJSON(w, r, http.StatusTooManyRequests, svc.cfg.rateExceededRespBody)
 	} else {
 		renderJSON(w, r, http.StatusTooManyRequests, api.MakeHTTPErrorResponse("rate limit exceeded", api.CodeRateLimitExceeded, logID))
 	}
@@ -151,3 +240,25 @@ func renderJSON(
 	render.Status(r, status)
 	render.JSON(w, r, v)
 }
+
+// readBody reads the request body, which can't be larger than limit bytes
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+}
+
+// isBodyTooLarge returns true if the error was returned reading a body larger than its limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// renderBodyReadingError replies requests whose body can't be read, with a 413 status
+// code if the body is larger than its limit or a 400 status code otherwise
+func (svc *service) renderBodyReadingError(w http.ResponseWriter, r *http.Request, caller string, err error) {
+	logID := svc.LogRequestFailure(r, fmt.Sprintf("[%s] body reading error: %+v", caller, err), err)
+	if isBodyTooLarge(err) {
+		renderJSON(w, r, http.StatusRequestEntityTooLarge, api.MakeHTTPErrorResponse("body too large", api.CodeBodyTooLarge, logID))
+		return
+	}
+	renderJSON(w, r, http.StatusBadRequest, api.MakeHTTPErrorResponse("body parsing error", api.CodeInvalidBody, logID))
+}
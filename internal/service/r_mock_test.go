@@ -6,8 +6,6 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"net/url"
-	"strings"
 	"testing"
 
 	"github.com/juan131/api-mock/pkg/api"
@@ -17,7 +15,7 @@ func Test_service_handleMock(t *testing.T) {
 	svc := &service{
 		cfg: &config{
 			failureCode:     http.StatusBadRequest,
-			successRespBody: map[string]interface{}{"success": true},
+			successRespBody: json.RawMessage(`{"success": true}`),
 			successCode:     http.StatusOK,
 			successRatio:    0.5,
 			methods:         []string{http.MethodGet},
@@ -115,149 +113,6 @@ func Test_service_handleMock(t *testing.T) {
 	}
 }
 
-func Test_service_handleBatchMock(t *testing.T) {
-	tests := []struct {
-		name         string
-		svc          *service
-		setupRequest func() *http.Request
-		respHandler  func(tt *testing.T, resp *httptest.ResponseRecorder)
-	}{
-		{
-			name: "success batch request with custom response body",
-			svc: &service{
-				cfg: &config{
-					failureCode:     http.StatusBadRequest,
-					successRespBody: map[string]interface{}{"success": true},
-					successCode:     http.StatusOK,
-					successRatio:    0.5,
-					methods:         []string{http.MethodGet},
-					subRoutes:       []string{"/foo"},
-				},
-				logger: newStructuredLogger(slog.LevelDebug),
-			},
-			setupRequest: func() *http.Request {
-				reqBody := `[{
-					"method": "GET",
-					"relative_url": "/foo",
-					"body": null
-				}, {
-					"method": "GET",
-					"relative_url": "/bar",
-					"body": null
-				}]`
-				encodedBody := url.Values{}
-				encodedBody.Set("batch", reqBody)
-
-				req := httptest.NewRequest(
-					http.MethodPost,
-					"/v1/mock/batch",
-					strings.NewReader(encodedBody.Encode()),
-				)
-				return req
-			},
-			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
-				if resp.Code != http.StatusOK {
-					tt.Errorf("expected status code %d, got %d", http.StatusOK, resp.Code)
-				}
-				if resp.Header().Get("Content-Type") != "application/json" {
-					tt.Errorf("expected content type %s, got %s", "application/json", resp.Header().Get("Content-Type"))
-				}
-				var batchResponse []api.BatchResponse
-				if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
-					tt.Errorf("could not unmarshal response body: %+v", err)
-				}
-
-				if len(batchResponse) != 2 {
-					tt.Errorf("expected batch response length %d, got %d", 2, len(batchResponse))
-				}
-
-				if batchResponse[0].Code != 200 || batchResponse[0].Body != "{\"success\":true}" {
-					tt.Errorf("expected response code %d and body %s, got %d and %s", 200, "{\"success\":true}", batchResponse[0].Code, batchResponse[0].Body)
-				}
-
-				if batchResponse[1].Code != 400 {
-					tt.Errorf("expected response code %d, got %d", 400, batchResponse[1].Code)
-				}
-
-				var errorResponse api.HTTPErrorResponse
-				if err := json.Unmarshal([]byte(batchResponse[1].Body), &errorResponse); err != nil {
-					tt.Errorf("could not unmarshal response body: %+v", err)
-				}
-
-				if errorResponse.Error.Message != "failed request" || errorResponse.Error.Code != api.CodeFailedRequest {
-					tt.Errorf("expected error message %s and code %d, got %s and %d", "failed request", api.CodeFailedRequest, errorResponse.Error.Message, errorResponse.Error.Code)
-				}
-			},
-		},
-		{
-			name: "success batch request with custom failure response body",
-			svc: &service{
-				cfg: &config{
-					failureRespBody: map[string]interface{}{"success": false},
-					failureCode:     http.StatusBadRequest,
-					successRespBody: map[string]interface{}{"success": true},
-					successCode:     http.StatusOK,
-					successRatio:    0.5,
-					methods:         []string{http.MethodGet},
-					subRoutes:       []string{"/foo"},
-				},
-				logger: newStructuredLogger(slog.LevelDebug),
-			},
-			setupRequest: func() *http.Request {
-				reqBody := `[{
-					"method": "GET",
-					"relative_url": "/foo",
-					"body": null
-				}, {
-					"method": "GET",
-					"relative_url": "/bar",
-					"body": null
-				}]`
-				encodedBody := url.Values{}
-				encodedBody.Set("batch", reqBody)
-
-				req := httptest.NewRequest(
-					http.MethodPost,
-					"/v1/mock/batch",
-					strings.NewReader(encodedBody.Encode()),
-				)
-				return req
-			},
-			respHandler: func(tt *testing.T, resp *httptest.ResponseRecorder) {
-				if resp.Code != http.StatusOK {
-					tt.Errorf("expected status code %d, got %d", http.StatusOK, resp.Code)
-				}
-				if resp.Header().Get("Content-Type") != "application/json" {
-					tt.Errorf("expected content type %s, got %s", "application/json", resp.Header().Get("Content-Type"))
-				}
-				var batchResponse []api.BatchResponse
-				if err := json.Unmarshal(resp.Body.Bytes(), &batchResponse); err != nil {
-					tt.Errorf("could not unmarshal response body: %+v", err)
-				}
-
-				if batchResponse[0].Code != 200 || batchResponse[0].Body != "{\"success\":true}" {
-					tt.Errorf("expected response code %d and body %s, got %d and %s", 200, "{\"success\":true}", batchResponse[0].Code, batchResponse[0].Body)
-				}
-
-				if batchResponse[1].Code != 400 || batchResponse[1].Body != "{\"success\":false}" {
-					tt.Errorf("expected response code %d and body %s, got %d and %s", 400, "{\"success\":false}", batchResponse[1].Code, batchResponse[1].Body)
-				}
-			},
-		},
-	}
-	t.Parallel()
-	for _, testToRun := range tests {
-		test := testToRun
-		t.Run(test.name, func(tt *testing.T) {
-			tt.Parallel()
-			resp := httptest.NewRecorder()
-			test.svc.reqCounter++
-			test.svc.handleBatchMock(resp, test.setupRequest())
-			test.respHandler(tt, resp)
-		})
-	}
-}
-
 func Test_handleNotFound(t *testing.T) {
 	svc := &service{
 		logger: newStructuredLogger(slog.LevelDebug),
@@ -387,7 +242,7 @@ func Test_handleRateLimitExceeded(t *testing.T) {
 			svc: &service{
 				logger: newStructuredLogger(slog.LevelDebug),
 				cfg: &config{
-					rateExceededRespBody: map[string]interface{}{"success": false},
+					rateExceededRespBody: json.RawMessage(`{"success": false}`),
 				},
 			},
 			setupRequest: func() *http.Request {
@@ -529,3 +384,83 @@ func Test_shouldFail(t *testing.T) {
 		})
 	}
 }
+
+func Test_service_handleRoute(t *testing.T) {
+	svc := &service{
+		cfg: &config{
+			failureCode:     http.StatusBadRequest,
+			successRespBody: json.RawMessage(`{"success": true}`),
+			successCode:     http.StatusOK,
+			successRatio:    1.0,
+		},
+		reqCounter: 1,
+		logger:     newStructuredLogger(slog.LevelDebug),
+	}
+	rt := &route{
+		Path:    "/foo",
+		Methods: []string{http.MethodGet},
+		Representations: []representation{
+			{ContentType: "application/json", payload: []byte(`{"id":1}`)},
+			{ContentType: "application/xml", payload: []byte(`<foo id="1"/>`)},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "no Accept header returns the first representation",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"id":1}`,
+		},
+		{
+			name:            "XML representation",
+			accept:          "application/xml, application/json;q=0.5",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/xml",
+			wantBody:        `<foo id="1"/>`,
+		},
+		{
+			name:            "no acceptable representation",
+			accept:          "text/csv",
+			wantCode:        http.StatusNotAcceptable,
+			wantContentType: "application/json",
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/v1/mock/foo", nil)
+			req.Header.Set("Accept", test.accept)
+			resp := httptest.NewRecorder()
+			svc.handleRoute(rt)(resp, req)
+
+			if resp.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d", test.wantCode, resp.Code)
+			}
+			if resp.Header().Get("Content-Type") != test.wantContentType {
+				tt.Errorf("expected content type %s, got %s", test.wantContentType, resp.Header().Get("Content-Type"))
+			}
+			if test.wantCode == http.StatusNotAcceptable {
+				var errorResponse api.HTTPErrorResponse
+				if err := json.Unmarshal(resp.Body.Bytes(), &errorResponse); err != nil {
+					tt.Errorf("could not unmarshal response body: %+v", err)
+				}
+				if errorResponse.Error.Code != api.CodeNotAcceptable {
+					tt.Errorf("expected error code %d, got %d", api.CodeNotAcceptable, errorResponse.Error.Code)
+				}
+				return
+			}
+			if resp.Body.String() != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, resp.Body.String())
+			}
+		})
+	}
+}
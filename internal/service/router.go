@@ -1,7 +1,9 @@
 package service
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -13,68 +15,200 @@ import (
 	"github.com/juan131/api-mock/pkg/authn"
 )
 
-const uriPrefix string = "/v1/mock"
+// MakeRouter initiates the http routers of the mock APIs served by the service.
+func (svc *service) MakeRouter() {
+	for _, api := range svc.mockAPIs() {
+		api.makeRouter()
+	}
+}
 
-// MakeRouter initiates the service's http router with a chi Mux object.
+// makeRouter initiates the mock API's http router with a chi Mux object.
 // This also include routes initializations.
-func (svc *service) MakeRouter() {
+func (svc *service) makeRouter() {
 	router := chi.NewRouter()
 
 	// Middlewares
 	router.Use(
 		cors.Handler(cors.Options{
 			AllowedOrigins:   []string{"*"},
-			AllowedMethods:   svc.cfg.methods,
+			AllowedMethods:   svc.corsMethods(),
 			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
 			ExposedHeaders:   []string{"Link"},
 			AllowCredentials: true,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		}),
 		middleware.Recoverer,
-		middleware.Timeout(30*time.Second),
-		middleware.Heartbeat("/live"),
-		middleware.Heartbeat("/ready"),
+		middleware.Heartbeat(livenessPath),
+		middleware.Heartbeat(readinessPath),
 		render.SetContentType(render.ContentTypeJSON),
 	)
 
-	// Endpoints handled by the service
-	router.Route(uriPrefix, func(r chi.Router) {
+	// Endpoints handled by the service (at the root level if there's no URI prefix)
+	mountPath := svc.cfg.uriPrefix
+	if mountPath == "" {
+		mountPath = "/"
+	}
+	router.Route(mountPath, func(r chi.Router) {
 		r.NotFound(svc.handleNotFound)
 		r.MethodNotAllowed(svc.handleMethodNotAllowed)
 
 		r.Use(svc.RequestLogger())
-		if svc.cfg.apiKey != "" {
-			r.Use(authn.ApiKeyAuth(svc.cfg.apiKey))
-		}
-		if svc.cfg.apiToken != "" {
-			r.Use(authn.BearerTokenAuth(svc.cfg.apiToken))
+		r.Use(stripHeadBody)
+		if schemes := svc.authSchemes(); len(schemes) > 0 {
+			r.Use(authn.AnyOf(schemes...))
 		}
 		r.Use(httprate.Limit(
 			svc.cfg.rateLimit, // requests
 			time.Second,       // per duration
 			httprate.WithLimitHandler(svc.handleRateLimitExceeded),
 		))
-		r.Use(svc.incReqCounter())
-
-		for _, subRoute := range svc.cfg.subRoutes {
-			for _, method := range svc.cfg.methods {
-				switch method {
-				case http.MethodGet:
-					r.Get(subRoute, svc.handleMock)
-				case http.MethodPost:
-					r.Post(subRoute, svc.handleMock)
-				case http.MethodPut:
-					r.Put(subRoute, svc.handleMock)
-				case http.MethodDelete:
-					r.Delete(subRoute, svc.handleMock)
-				case http.MethodPatch:
-					r.Patch(subRoute, svc.handleMock)
+
+		// Streaming routes serve long-lived connections, so they can't time out or hold the service lock
+		for i := range svc.cfg.routes {
+			rt := &svc.cfg.routes[i]
+			if rt.isStream() {
+				for _, method := range rt.Methods {
+					r.Method(method, rt.Path, svc.requireClaims(rt, svc.handleStream(rt)))
 				}
 			}
 		}
 
-		r.Post("/batch", svc.handleBatchMock)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(30 * time.Second))
+
+			for _, subRoute := range svc.cfg.subRoutes {
+				for _, method := range svc.cfg.methods {
+					r.Method(method, subRoute, svc.incReqCounter(svc.cfg.respDelay, svc.handleMock))
+				}
+			}
+
+			for i := range svc.cfg.routes {
+				rt := &svc.cfg.routes[i]
+				if !rt.isStream() {
+					for _, method := range rt.Methods {
+						r.Method(method, rt.Path, svc.requireClaims(rt, svc.incReqCounter(svc.routeDelay(rt), svc.handleRoute(rt))))
+					}
+				}
+				if rt.Job != nil {
+					r.Get(rt.Job.StatusPath, svc.requireClaims(rt, svc.incReqCounter(0, svc.handleJobStatus)))
+				}
+			}
+
+			// batch requests don't hold the service lock, as their requests are dispatched through the router
+			r.Post(batchPath, svc.handleBatchMock)
+
+			// Admin endpoints, authenticated and rate limited like the mocked routes
+			r.Post(eventsPath, svc.handleEvent)
+		})
 	})
 
 	svc.router = router
 }
+
+// corsMethods returns the methods allowed in CORS requests, which are the methods of
+// the sub routes and of every route (including custom methods and batch requests)
+func (svc *service) corsMethods() []string {
+	methods := append([]string{}, svc.cfg.methods...)
+	add := func(method string) {
+		if !stringSliceContains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	for _, rt := range svc.cfg.routes {
+		for _, method := range rt.Methods {
+			add(method)
+		}
+		if rt.Job != nil {
+			add(http.MethodGet)
+		}
+	}
+	add(http.MethodPost) // batch requests
+
+	return methods
+}
+
+// authSchemes returns the authentication schemes accepted by the mock API (none if it's not authenticated)
+func (svc *service) authSchemes() []authn.Scheme {
+	var schemes []authn.Scheme
+	if len(svc.cfg.apiKeys) > 0 {
+		schemes = append(schemes, authn.ApiKey(svc.cfg.apiKeys...))
+	}
+	if len(svc.cfg.apiTokens) > 0 {
+		schemes = append(schemes, authn.BearerToken(svc.cfg.apiTokens...))
+	}
+	if len(svc.cfg.basicAuthUsers) > 0 {
+		schemes = append(schemes, authn.Basic(svc.cfg.basicAuthUsers))
+	}
+	if svc.cfg.jwt != nil {
+		schemes = append(schemes, authn.JWT(*svc.cfg.jwt))
+	}
+
+	return schemes
+}
+
+// validateRoutePattern checks a route path is a valid routing pattern, which may
+// capture path parameters (e.g. "/users/{id}" or "/users/{id:[0-9]+}") and end
+// with a wildcard capturing the rest of the path (e.g. "/files/*")
+func validateRoutePattern(pattern string) (err error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("path %q must start with /", pattern)
+	}
+
+	// chi panics when registering invalid patterns
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid path %q: %v", pattern, r)
+		}
+	}()
+	chi.NewRouter().Get(pattern, func(http.ResponseWriter, *http.Request) {})
+
+	return nil
+}
+
+// pathParams returns the path parameters captured by the route matching the request,
+// the rest of the path matched by a trailing wildcard being available as "*"
+func pathParams(r *http.Request) map[string]string {
+	params := map[string]string{}
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return params
+	}
+
+	for i, key := range rctx.URLParams.Keys {
+		if i < len(rctx.URLParams.Values) {
+			params[key] = rctx.URLParams.Values[i]
+		}
+	}
+	// the URI prefix is mounted with a wildcard that is reset once matched
+	if params["*"] == "" {
+		delete(params, "*")
+	}
+
+	return params
+}
+
+// stripHeadBody is a middleware discarding the response body of HEAD requests,
+// so they can be mocked with the same responses as GET requests
+func stripHeadBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w = &headResponseWriter{ResponseWriter: w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headResponseWriter is a http.ResponseWriter discarding the response body
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Write implements the http.ResponseWriter interface
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Unwrap returns the original http.ResponseWriter (used by http.ResponseController)
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
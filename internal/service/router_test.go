@@ -0,0 +1,355 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_service_makeRouter(t *testing.T) {
+	tests := []struct {
+		name      string
+		uriPrefix string
+		method    string
+		path      string
+		wantCode  int
+	}{
+		{
+			name:      "prefixed route",
+			uriPrefix: "/v1/mock",
+			path:      "/v1/mock/users",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "route outside the prefix",
+			uriPrefix: "/v1/mock",
+			path:      "/users",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "root-level route",
+			uriPrefix: "",
+			path:      "/users",
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:      "root-level batch route",
+			uriPrefix: "",
+			method:    http.MethodPost,
+			path:      "/batch",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "root-level unknown route",
+			uriPrefix: "",
+			path:      "/orders",
+			wantCode:  http.StatusNotFound,
+		},
+		{
+			name:      "health check with root-level routes",
+			uriPrefix: "",
+			path:      "/live",
+			wantCode:  http.StatusOK,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			svc := &service{
+				cfg: &config{
+					uriPrefix:       test.uriPrefix,
+					methods:         []string{http.MethodGet},
+					subRoutes:       []string{"/users"},
+					successCode:     http.StatusOK,
+					successRespBody: json.RawMessage(`{"success":true}`),
+					successRatio:    1.0,
+					rateLimit:       1000,
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			method := http.MethodGet
+			if test.method != "" {
+				method = test.method
+			}
+			req := httptest.NewRequest(method, test.path, nil)
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d", test.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func Test_service_pathParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		subRoute string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "path parameter",
+			subRoute: "/users/{id}",
+			path:     "/v1/mock/users/42",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"42","rest":""}`,
+		},
+		{
+			name:     "regex path parameter",
+			subRoute: "/users/{id:[0-9]+}",
+			path:     "/v1/mock/users/42",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"42","rest":""}`,
+		},
+		{
+			name:     "regex path parameter not matching",
+			subRoute: "/users/{id:[0-9]+}",
+			path:     "/v1/mock/users/john",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "wildcard",
+			subRoute: "/users/{id}/files/*",
+			path:     "/v1/mock/users/42/files/docs/cv.pdf",
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"42","rest":"docs/cv.pdf"}`,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			svc := &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					methods:         []string{http.MethodGet},
+					subRoutes:       []string{test.subRoute},
+					successCode:     http.StatusOK,
+					successRespBody: json.RawMessage(`{"id":"{{.Params.id}}","rest":"{{index .Params "*"}}"}`),
+					successRatio:    1.0,
+					rateLimit:       1000,
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d", test.wantCode, w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); test.wantBody != "" && got != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_validateRoutePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{
+			name:    "static path",
+			pattern: "/users",
+		},
+		{
+			name:    "path parameters and wildcard",
+			pattern: "/users/{id:[0-9]+}/files/*",
+		},
+		{
+			name:    "relative path",
+			pattern: "users",
+			wantErr: true,
+		},
+		{
+			name:    "wildcard not at the end",
+			pattern: "/users/*/files",
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			pattern: "/users/{id:[0-9+}",
+			wantErr: true,
+		},
+		{
+			name:    "duplicated parameter",
+			pattern: "/users/{id}/friends/{id}",
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if err := validateRoutePattern(test.pattern); (err != nil) != test.wantErr {
+				tt.Errorf("validateRoutePattern() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func Test_service_makeRouter_methods(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "GET request",
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+			wantBody: `{"success":true}`,
+		},
+		{
+			name:     "HEAD request without body",
+			method:   http.MethodHead,
+			wantCode: http.StatusOK,
+			wantBody: "",
+		},
+		{
+			name:     "OPTIONS request",
+			method:   http.MethodOptions,
+			wantCode: http.StatusOK,
+			wantBody: `{"success":true}`,
+		},
+		{
+			name:     "custom method",
+			method:   "PROPFIND",
+			wantCode: http.StatusOK,
+			wantBody: `{"success":true}`,
+		},
+		{
+			name:     "method not mocked",
+			method:   http.MethodPost,
+			wantCode: http.StatusNotFound,
+		},
+	}
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND"}
+	for _, method := range methods {
+		if _, err := parseMethod(method); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &service{
+		cfg: &config{
+			uriPrefix:       "/v1/mock",
+			methods:         methods,
+			subRoutes:       []string{"/files/{name}"},
+			successCode:     http.StatusOK,
+			successRespBody: json.RawMessage(`{"success":true}`),
+			successRatio:    1.0,
+			rateLimit:       1000,
+		},
+		reqCounter: 1,
+		logger:     newStructuredLogger(slog.LevelDebug),
+	}
+	svc.makeRouter()
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			req := httptest.NewRequest(test.method, "/v1/mock/files/docs", nil)
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d", test.wantCode, w.Code)
+			}
+			if got := strings.TrimSpace(w.Body.String()); test.wantCode == http.StatusOK && got != test.wantBody {
+				tt.Errorf("expected body %q, got %q", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_service_makeRouter_cors(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		wantAllowed bool
+	}{
+		{
+			name:        "method of the sub routes",
+			method:      http.MethodGet,
+			wantAllowed: true,
+		},
+		{
+			name:        "custom method of the sub routes",
+			method:      "PROPFIND",
+			wantAllowed: true,
+		},
+		{
+			name:        "method declared only in the routes file",
+			method:      http.MethodPatch,
+			wantAllowed: true,
+		},
+		{
+			name:        "custom method declared only in the routes file",
+			method:      "PURGE",
+			wantAllowed: true,
+		},
+		{
+			name:        "method not mocked",
+			method:      http.MethodDelete,
+			wantAllowed: false,
+		},
+	}
+	rt := route{Path: "/files/{name}", Methods: []string{"patch", "purge"}}
+	if err := rt.validate(); err != nil {
+		t.Fatalf("invalid route: %v", err)
+	}
+	methods := []string{http.MethodGet, "PROPFIND"}
+	for _, method := range methods {
+		if _, err := parseMethod(method); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &service{
+		cfg: &config{
+			uriPrefix:       "/v1/mock",
+			methods:         methods,
+			subRoutes:       []string{"/"},
+			routes:          []route{rt},
+			successCode:     http.StatusOK,
+			successRespBody: json.RawMessage(`{"success":true}`),
+			successRatio:    1.0,
+			rateLimit:       1000,
+		},
+		reqCounter: 1,
+		logger:     newStructuredLogger(slog.LevelDebug),
+	}
+	svc.makeRouter()
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/v1/mock/files/docs", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", test.method)
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if allowed := w.Header().Get("Access-Control-Allow-Origin") != ""; allowed != test.wantAllowed {
+				tt.Errorf("expected preflight allowed %v, got %v (headers %v)", test.wantAllowed, allowed, w.Header())
+			}
+		})
+	}
+}
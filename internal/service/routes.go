@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juan131/api-mock/pkg/schema"
+)
+
+// route is a mocked route defined in the routes file
+type route struct {
+	Path            string                 `json:"path"`            // route pattern relative to the URI prefix
+	Methods         []string               `json:"methods"`         // supported methods (defaults to GET)
+	Delay           *int                   `json:"delay"`           // response delay overriding RESP_DELAY (in milliseconds)
+	Claims          map[string]interface{} `json:"claims"`          // claims the JWT authenticating requests must hold
+	Representations []representation       `json:"representations"` // alternative representations of the success response
+	Schema          schema.Schema          `json:"schema"`          // JSON Schema of the success response body
+	WebSocket       *webSocket             `json:"websocket"`       // WebSocket route definition
+	SSE             *sse                   `json:"sse"`             // Server-Sent Events route definition
+	LongPoll        *longPoll              `json:"longPoll"`        // long-polling route definition
+	GraphQL         *graphQL               `json:"graphql"`         // GraphQL route definition
+	JSONRPC         *jsonRPC               `json:"jsonrpc"`         // JSON-RPC 2.0 route definition
+	SOAP            *soap                  `json:"soap"`            // SOAP route definition
+	Job             *asyncJob              `json:"job"`             // asynchronous job route definition
+	Webhooks        []webhook              `json:"webhooks"`        // outgoing requests sent after replying
+}
+
+// representation is one of the possible encodings of a route's success response
+type representation struct {
+	ContentType string          `json:"contentType"` // media type of the representation
+	Body        json.RawMessage `json:"body"`        // any JSON value for JSON media types, a JSON string otherwise
+	Base64      bool            `json:"base64"`      // whether the body string is base64 encoded (binary payloads)
+	payload     []byte          // raw payload written to the response
+}
+
+// isStream returns true if the route serves long-lived connections
+func (rt *route) isStream() bool {
+	return rt.WebSocket != nil || rt.SSE != nil || rt.LongPoll != nil
+}
+
+// routeDelay returns the response delay of a route
+func (svc *service) routeDelay(rt *route) time.Duration {
+	if rt.Delay != nil {
+		return time.Duration(*rt.Delay) * time.Millisecond
+	}
+
+	return svc.cfg.respDelay
+}
+
+// loadRoutes loads the route definitions from a JSON file
+func loadRoutes(path string) ([]route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []route
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&routes); err != nil {
+		return nil, fmt.Errorf("invalid json format: %w", err)
+	}
+
+	for i := range routes {
+		if err = routes[i].validate(); err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+
+	return routes, nil
+}
+
+// validate validates the route definition and sets its defaults
+func (rt *route) validate() error {
+	if err := validateRoutePattern(rt.Path); err != nil {
+		return err
+	}
+
+	if len(rt.Methods) == 0 {
+		rt.Methods = []string{http.MethodGet}
+		if rt.GraphQL != nil {
+			rt.Methods = []string{http.MethodGet, http.MethodPost}
+		}
+		if rt.JSONRPC != nil || rt.SOAP != nil || rt.Job != nil {
+			rt.Methods = []string{http.MethodPost}
+		}
+	}
+	for i, method := range rt.Methods {
+		var err error
+		if rt.Methods[i], err = parseMethod(method); err != nil {
+			return err
+		}
+	}
+
+	if rt.Delay != nil && (*rt.Delay < 0 || time.Duration(*rt.Delay)*time.Millisecond > maxRespDelay) {
+		return fmt.Errorf("delay must be between 0 and %d", maxRespDelay/time.Millisecond)
+	}
+	for name, value := range rt.Claims {
+		if _, ok := value.(map[string]interface{}); ok {
+			return fmt.Errorf("claim %s can't be an object", name)
+		}
+	}
+
+	for i := range rt.Representations {
+		if err := rt.Representations[i].validate(); err != nil {
+			return fmt.Errorf("representation %d: %w", i, err)
+		}
+	}
+
+	if rt.WebSocket != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil || rt.SSE != nil {
+			return errors.New("websocket routes can't have a schema, representations or events")
+		}
+		if len(rt.Methods) != 1 || rt.Methods[0] != http.MethodGet {
+			return errors.New("websocket routes only support the GET method")
+		}
+		if err := rt.WebSocket.validate(); err != nil {
+			return fmt.Errorf("invalid websocket: %w", err)
+		}
+	}
+
+	if rt.GraphQL != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil || rt.isStream() {
+			return errors.New("graphql routes can't have a schema, representations, events or websocket")
+		}
+		for _, method := range rt.Methods {
+			if method != http.MethodGet && method != http.MethodPost {
+				return errors.New("graphql routes only support the GET and POST methods")
+			}
+		}
+		if err := rt.GraphQL.validate(); err != nil {
+			return fmt.Errorf("invalid graphql: %w", err)
+		}
+	}
+
+	if rt.JSONRPC != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil || rt.isStream() || rt.GraphQL != nil {
+			return errors.New("jsonrpc routes can't have a schema, representations, events, websocket or graphql")
+		}
+		if len(rt.Methods) != 1 || rt.Methods[0] != http.MethodPost {
+			return errors.New("jsonrpc routes only support the POST method")
+		}
+		if err := rt.JSONRPC.validate(); err != nil {
+			return fmt.Errorf("invalid jsonrpc: %w", err)
+		}
+	}
+
+	if rt.SOAP != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil || rt.isStream() || rt.GraphQL != nil || rt.JSONRPC != nil {
+			return errors.New("soap routes can't have a schema, representations, events, websocket, graphql or jsonrpc")
+		}
+		if len(rt.Methods) != 1 || rt.Methods[0] != http.MethodPost {
+			return errors.New("soap routes only support the POST method")
+		}
+		if err := rt.SOAP.validate(); err != nil {
+			return fmt.Errorf("invalid soap: %w", err)
+		}
+	}
+
+	if rt.Job != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil || rt.isStream() || rt.GraphQL != nil || rt.JSONRPC != nil || rt.SOAP != nil {
+			return errors.New("job routes can't have a schema, representations, events, websocket, graphql, jsonrpc or soap")
+		}
+		for _, method := range rt.Methods {
+			if method == http.MethodGet || method == http.MethodHead {
+				return errors.New("job routes don't support the GET and HEAD methods")
+			}
+		}
+		if err := rt.Job.validate(rt.Path); err != nil {
+			return fmt.Errorf("invalid job: %w", err)
+		}
+	}
+
+	if rt.LongPoll != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil || rt.WebSocket != nil || rt.SSE != nil {
+			return errors.New("long-polling routes can't have a schema, representations, events or websocket")
+		}
+		if err := rt.LongPoll.validate(); err != nil {
+			return fmt.Errorf("invalid longPoll: %w", err)
+		}
+	}
+
+	if rt.SSE != nil {
+		if len(rt.Representations) > 0 || rt.Schema != nil {
+			return errors.New("sse routes can't have a schema or representations")
+		}
+		if err := rt.SSE.validate(); err != nil {
+			return fmt.Errorf("invalid sse: %w", err)
+		}
+	}
+
+	for i := range rt.Webhooks {
+		if rt.isStream() {
+			return errors.New("streaming routes can't have webhooks")
+		}
+		if err := rt.Webhooks[i].validate(); err != nil {
+			return fmt.Errorf("webhook %d: %w", i, err)
+		}
+	}
+
+	if rt.Schema != nil {
+		if len(rt.Representations) > 0 {
+			return errors.New("only one of schema or representations can be set")
+		}
+		// Check every branch of the schema to detect invalid schemas on startup
+		if err := schema.Validate(rt.Schema); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validate validates the representation and prepares its payload
+func (rep *representation) validate() error {
+	mediaType, _, err := mime.ParseMediaType(rep.ContentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %w", rep.ContentType, err)
+	}
+
+	var body string
+	isJSON := isJSONMediaType(mediaType) && !rep.Base64
+	if isJSON && json.Unmarshal(rep.Body, &body) == nil && isTemplate([]byte(body)) {
+		// JSON bodies can be provided as a string holding a template (e.g. to render numbers)
+		rep.payload = []byte(body)
+	} else if isJSON {
+		buf := &bytes.Buffer{}
+		if err = json.Compact(buf, rep.Body); err != nil {
+			return fmt.Errorf("invalid json body: %w", err)
+		}
+		rep.payload = buf.Bytes()
+	} else {
+		if err = json.Unmarshal(rep.Body, &body); err != nil {
+			return fmt.Errorf("body must be a string for content type %s", mediaType)
+		}
+		if rep.Base64 {
+			rep.payload, err = base64.StdEncoding.DecodeString(body)
+			if err != nil {
+				return fmt.Errorf("invalid base64 body: %w", err)
+			}
+			return nil
+		}
+		rep.payload = []byte(body)
+	}
+
+	if isTemplate(rep.payload) {
+		if _, err = parseTemplate(string(rep.payload), nil); err != nil {
+			return fmt.Errorf("invalid body template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// mediaType returns the representation media type without parameters
+func (rep *representation) mediaType() string {
+	mediaType, _, _ := mime.ParseMediaType(rep.ContentType)
+	return mediaType
+}
+
+// negotiate returns the route representation that best matches
+// the given Accept header, or nil if none is acceptable
+func (rt *route) negotiate(accept string) *representation {
+	offers := make([]string, 0, len(rt.Representations))
+	for _, rep := range rt.Representations {
+		offers = append(offers, rep.ContentType)
+	}
+
+	idx := negotiateContentType(accept, offers)
+	if idx < 0 {
+		return nil
+	}
+
+	return &rt.Representations[idx]
+}
+
+// isJSONMediaType returns true if the media type is JSON based (e.g. application/json or application/problem+json)
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
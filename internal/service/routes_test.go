@@ -0,0 +1,278 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_negotiateContentType(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/csv"}
+	tests := []struct {
+		name   string
+		accept string
+		want   int
+	}{
+		{
+			name:   "empty Accept header picks the first offer",
+			accept: "",
+			want:   0,
+		},
+		{
+			name:   "exact match",
+			accept: "application/xml",
+			want:   1,
+		},
+		{
+			name:   "type wildcard",
+			accept: "text/*",
+			want:   2,
+		},
+		{
+			name:   "any media type picks the first offer",
+			accept: "*/*",
+			want:   0,
+		},
+		{
+			name:   "quality values",
+			accept: "application/json;q=0.5, application/xml;q=0.9, */*;q=0.1",
+			want:   1,
+		},
+		{
+			name:   "most specific range wins",
+			accept: "application/*;q=0.8, application/json;q=0",
+			want:   1,
+		},
+		{
+			name:   "no acceptable offer",
+			accept: "image/png",
+			want:   -1,
+		},
+		{
+			name:   "malformed ranges are ignored",
+			accept: "not a media type, text/csv",
+			want:   2,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if got := negotiateContentType(test.accept, offers); got != test.want {
+				tt.Errorf("negotiateContentType() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func Test_loadRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		validate func(tt *testing.T, routes []route)
+		wantErr  bool
+	}{
+		{
+			name: "valid routes",
+			content: `[{
+				"path": "/users",
+				"representations": [
+					{"contentType": "application/json", "body": [{"id": 1}]},
+					{"contentType": "application/xml", "body": "<users><user id=\"1\"/></users>"},
+					{"contentType": "application/x-protobuf", "body": "CAE=", "base64": true}
+				]
+			}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || len(routes[0].Representations) != 3 {
+					tt.Fatalf("unexpected routes %+v", routes)
+				}
+				if len(routes[0].Methods) != 1 || routes[0].Methods[0] != "GET" {
+					tt.Errorf("expected default methods [GET], got %v", routes[0].Methods)
+				}
+				reps := routes[0].Representations
+				if string(reps[0].payload) != `[{"id":1}]` {
+					tt.Errorf("unexpected JSON payload %s", reps[0].payload)
+				}
+				if string(reps[1].payload) != `<users><user id="1"/></users>` {
+					tt.Errorf("unexpected XML payload %s", reps[1].payload)
+				}
+				if string(reps[2].payload) != "\x08\x01" {
+					tt.Errorf("unexpected protobuf payload %v", reps[2].payload)
+				}
+			},
+		},
+		{
+			name:    "valid schema",
+			content: `[{"path": "/users", "schema": {"type": "array", "items": {"$ref": "#/$defs/user"}, "$defs": {"user": {"type": "object"}}}}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || routes[0].Schema == nil {
+					tt.Errorf("unexpected routes %+v", routes)
+				}
+			},
+		},
+		{
+			name:    "invalid schema",
+			content: `[{"path": "/users", "schema": {"$ref": "#/$defs/user"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "both schema and representations",
+			content: `[{"path": "/users", "schema": {"type": "object"}, "representations": [{"contentType": "text/plain", "body": "foo"}]}]`,
+			wantErr: true,
+		},
+		{
+			name:    "custom methods",
+			content: `[{"path": "/files/*", "methods": ["PROPFIND", "mkcol"]}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || len(routes[0].Methods) != 2 || routes[0].Methods[1] != "MKCOL" {
+					tt.Errorf("unexpected routes %+v", routes)
+				}
+			},
+		},
+		{
+			name:    "valid websocket",
+			content: `[{"path": "/ws", "websocket": {"onConnect": [{"data": {"type": "hello"}}], "replies": [{"match": {"regex": "^ping$"}, "messages": [{"data": "pong"}]}]}}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || !routes[0].isStream() || string(routes[0].WebSocket.OnConnect[0].payload) != `{"type":"hello"}` {
+					tt.Errorf("unexpected routes %+v", routes)
+				}
+			},
+		},
+		{
+			name:    "websocket with a method other than GET",
+			content: `[{"path": "/ws", "methods": ["POST"], "websocket": {}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "websocket with an invalid regex",
+			content: `[{"path": "/ws", "websocket": {"replies": [{"match": {"regex": "(ping"}, "messages": [{"data": "pong"}]}]}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "websocket with an invalid close code",
+			content: `[{"path": "/ws", "websocket": {"disconnect": {"after": 1000, "code": 999}}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "websocket with a reserved close code",
+			content: `[{"path": "/ws", "websocket": {"disconnect": {"after": 1000, "code": 1005}}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "websocket with a reserved TLS close code",
+			content: `[{"path": "/ws", "websocket": {"disconnect": {"after": 1000, "code": 1015}}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "websocket with an unassigned close code",
+			content: `[{"path": "/ws", "websocket": {"disconnect": {"after": 1000, "code": 2000}}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "websocket with an application close code",
+			content: `[{"path": "/ws", "websocket": {"disconnect": {"after": 1000, "code": 4000}}}]`,
+		},
+		{
+			name:    "valid jsonrpc",
+			content: `[{"path": "/rpc", "jsonrpc": {"methods": {"eth_blockNumber": {"result": "0x10"}}}}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || len(routes[0].Methods) != 1 || routes[0].Methods[0] != "POST" {
+					tt.Errorf("unexpected routes %+v", routes)
+				}
+			},
+		},
+		{
+			name:    "jsonrpc with a method other than POST",
+			content: `[{"path": "/rpc", "methods": ["GET"], "jsonrpc": {"methods": {"eth_blockNumber": {"result": "0x10"}}}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "soap with a method other than POST",
+			content: `[{"path": "/payments", "methods": ["GET"], "soap": {"operations": [{"response": "<ChargeResponse/>"}]}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "valid job",
+			content: `[{"path": "/exports", "job": {"polls": 2, "result": {"url": "/files/1.csv"}}}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || routes[0].Methods[0] != "POST" || routes[0].Job.StatusPath != "/exports/{jobId}" {
+					tt.Errorf("unexpected routes %+v", routes)
+				}
+			},
+		},
+		{
+			name:    "job with the GET method",
+			content: `[{"path": "/exports", "methods": ["GET"], "job": {}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "job status path without job id",
+			content: `[{"path": "/exports", "job": {"statusPath": "/exports/status"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "job status path with a parameter not captured by the route",
+			content: `[{"path": "/exports", "job": {"statusPath": "/{tenant}/jobs/{jobId}"}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "valid delay",
+			content: `[{"path": "/users", "delay": 200}]`,
+			validate: func(tt *testing.T, routes []route) {
+				if len(routes) != 1 || routes[0].Delay == nil || *routes[0].Delay != 200 {
+					tt.Errorf("unexpected routes %+v", routes)
+				}
+			},
+		},
+		{
+			name:    "delay out of range",
+			content: `[{"path": "/users", "delay": 60000}]`,
+			wantErr: true,
+		},
+		{
+			name:    "object claim",
+			content: `[{"path": "/users", "claims": {"address": {"country": "ES"}}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid path",
+			content: `[{"path": "users"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid method",
+			content: `[{"path": "/users", "methods": ["GET", "BAD METHOD"]}]`,
+			wantErr: true,
+		},
+		{
+			name:    "non-string body for a non-JSON representation",
+			content: `[{"path": "/users", "representations": [{"contentType": "text/csv", "body": {"id": 1}}]}]`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			content: `[{"path": "/users", "foo": "bar"}]`,
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			path := filepath.Join(tt.TempDir(), "routes.json")
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				tt.Fatal(err)
+			}
+
+			got, err := loadRoutes(path)
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("loadRoutes() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if test.validate != nil {
+				test.validate(tt, got)
+			}
+		})
+	}
+}
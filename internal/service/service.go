@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/juan131/api-mock/pkg/fake"
 )
 
 const gracefulPeriod = time.Second * 30
@@ -26,11 +28,17 @@ type Service interface {
 }
 
 type service struct {
-	cfg        *config      // service configuration
-	router     *chi.Mux     // http router
-	reqCounter int          // request counter
-	mu         sync.Mutex   // Mutual exclusion lock
-	logger     *slog.Logger // logger
+	cfg        *config         // service configuration
+	router     *chi.Mux        // http router
+	reqCounter int             // request counter
+	mu         sync.Mutex      // Mutual exclusion lock
+	logger     *slog.Logger    // logger
+	fake       *fake.Generator // fake data generator used by response templates
+	fakeOnce   sync.Once       // fake data generator initialization
+	templates  sync.Map        // parsed body templates by body
+	apis       []*service      // mock APIs defined in the APIs file (if any)
+	jobs       map[string]*job // asynchronous jobs submitted by id
+	events     eventHub        // events answering long-polling requests
 }
 
 // NewService creates a new service
@@ -49,49 +57,167 @@ func NewService() Service {
 
 // ListenAndServe listens and serves the http requests
 func (svc *service) ListenAndServe() {
-	// Listen and serve
-	srv := &http.Server{
-		Addr:              fmt.Sprintf(":%d", svc.cfg.port),
-		Handler:           svc.router,
-		ReadHeaderTimeout: 5 * time.Second,
+	servers, err := svc.makeServers()
+	if err != nil {
+		svc.logger.Error("server configuration error", "error", err)
+		os.Exit(1)
 	}
-	svc.logger.Info(fmt.Sprintf("service attempting to listen on port %d", svc.cfg.port))
-	if err := svc.listenAndShutdown(srv); err != nil {
+
+	// Listen and serve
+	if err := svc.listenAndShutdown(servers...); err != nil {
 		svc.logger.Error("server error", "error", err)
 		os.Exit(1)
 	}
 }
 
+// makeServers returns the http servers for the mock APIs, serving the
+// APIs sharing a port with the same server based on the request host
+func (svc *service) makeServers() ([]*http.Server, error) {
+	var ports, tlsPorts []int
+	apisByPort, apisByTLSPort := map[int][]*service{}, map[int][]*service{}
+	for _, api := range svc.mockAPIs() {
+		if _, found := apisByPort[api.cfg.port]; !found {
+			ports = append(ports, api.cfg.port)
+		}
+		apisByPort[api.cfg.port] = append(apisByPort[api.cfg.port], api)
+		if api.cfg.tlsPort != 0 {
+			if _, found := apisByTLSPort[api.cfg.tlsPort]; !found {
+				tlsPorts = append(tlsPorts, api.cfg.tlsPort)
+			}
+			apisByTLSPort[api.cfg.tlsPort] = append(apisByTLSPort[api.cfg.tlsPort], api)
+		}
+	}
+
+	servers := make([]*http.Server, 0, len(ports)+len(tlsPorts))
+	for _, port := range ports {
+		if _, found := apisByTLSPort[port]; found {
+			return nil, fmt.Errorf("port %d can't be used for both HTTP and HTTPS", port)
+		}
+		apis := apisByPort[port]
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		for _, api := range apis {
+			if api.cfg.h2c {
+				protocols.SetUnencryptedHTTP2(true)
+			}
+		}
+		servers = append(servers, &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           newHostRouter(apis),
+			ReadHeaderTimeout: 5 * time.Second,
+			Protocols:         protocols,
+		})
+		svc.logger.Info(fmt.Sprintf("service attempting to listen on port %d (protocols: %s)", port, protocols))
+	}
+
+	for _, port := range tlsPorts {
+		apis := apisByTLSPort[port]
+		tlsConfig, err := mergeTLSConfigs(apis)
+		if err != nil {
+			return nil, fmt.Errorf("TLS configuration error: %w", err)
+		}
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		servers = append(servers, &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           newHostRouter(apis),
+			ReadHeaderTimeout: 5 * time.Second,
+			TLSConfig:         tlsConfig,
+			Protocols:         protocols,
+		})
+		svc.logger.Info(fmt.Sprintf("service attempting to listen on port %d (TLS, protocols: %s)", port, protocols))
+	}
+
+	grpcPorts := map[int]bool{}
+	for _, api := range svc.mockAPIs() {
+		port := api.cfg.grpcPort
+		if port == 0 {
+			continue
+		}
+		if len(apisByPort[port]) > 0 || len(apisByTLSPort[port]) > 0 || grpcPorts[port] {
+			return nil, fmt.Errorf("gRPC port %d can't be shared", port)
+		}
+		grpcPorts[port] = true
+
+		// gRPC requires HTTP/2, served over cleartext (prior knowledge)
+		protocols := new(http.Protocols)
+		protocols.SetUnencryptedHTTP2(true)
+		servers = append(servers, &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           api.newGRPCServer(),
+			ReadHeaderTimeout: 5 * time.Second,
+			Protocols:         protocols,
+		})
+		svc.logger.Info(fmt.Sprintf("service attempting to listen on port %d (gRPC)", port))
+	}
+
+	return servers, nil
+}
+
+// mockAPIs returns the mock APIs served by the service
+func (svc *service) mockAPIs() []*service {
+	if len(svc.apis) > 0 {
+		return svc.apis
+	}
+
+	return []*service{svc}
+}
+
 // LoadConfig loads the service configuration
 func (svc *service) LoadConfig() error {
-	var err error
-	svc.cfg, err = loadConfigFromEnv()
-	if err != nil {
-		return err
+	if apisFile := os.Getenv("APIS_FILE"); apisFile != "" {
+		cfgs, err := loadAPIsConfig(apisFile)
+		if err != nil {
+			return fmt.Errorf("invalid APIs file %s: %w", apisFile, err)
+		}
+		for _, cfg := range cfgs {
+			svc.apis = append(svc.apis, &service{cfg: cfg, logger: svc.logger.With("api", cfg.name)})
+		}
+	} else {
+		var err error
+		svc.cfg, err = loadConfigFromEnv()
+		if err != nil {
+			return err
+		}
 	}
 
-	svc.logger.Debug("Mock svc configuration:")
-	svc.logger.Debug(fmt.Sprintf("API rate limit: %d requests per second", svc.cfg.rateLimit))
-	svc.logger.Debug(fmt.Sprintf("Success ratio: %f", svc.cfg.successRatio))
-	svc.logger.Debug(fmt.Sprintf("Supported sub routes: %s", svc.cfg.subRoutes))
-	svc.logger.Debug(fmt.Sprintf("Supported methods: %s", svc.cfg.methods))
+	for _, api := range svc.mockAPIs() {
+		api.logger.Debug("Mock svc configuration:")
+		api.logger.Debug(fmt.Sprintf("Host: %s, port: %d, URI prefix: %s", api.cfg.host, api.cfg.port, api.cfg.uriPrefix))
+		api.logger.Debug(fmt.Sprintf("API rate limit: %d requests per second", api.cfg.rateLimit))
+		api.logger.Debug(fmt.Sprintf("Success ratio: %f", api.cfg.successRatio))
+		api.logger.Debug(fmt.Sprintf("Supported sub routes: %s", api.cfg.subRoutes))
+		api.logger.Debug(fmt.Sprintf("Supported methods: %s", api.cfg.methods))
+		if api.cfg.grpcServices != nil {
+			api.logger.Debug(fmt.Sprintf("gRPC port: %d, methods: %d", api.cfg.grpcPort, len(api.cfg.grpcServices.methods)))
+		}
+	}
 
 	return nil
 }
 
 // listenAndShutdown starts listening and serving the http requests asynchronously while at the same time listening for
-// sigterm signals from the OS. In case that the server is in a shutdown cycle, it give a grace period for existing
-// http requests to be served before fully closing down the server. This call is blocking.
-func (svc *service) listenAndShutdown(server *http.Server) error {
+// sigterm signals from the OS. In case that the servers are in a shutdown cycle, it give a grace period for existing
+// http requests to be served before fully closing down the servers. This call is blocking.
+func (svc *service) listenAndShutdown(servers ...*http.Server) error {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			svc.logger.Error("fail on listen", "error", err)
-			os.Exit(1)
-		}
-	}()
+	for _, server := range servers {
+		go func(server *http.Server) {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				svc.logger.Error("fail on listen", "error", err)
+				os.Exit(1)
+			}
+		}(server)
+	}
 	svc.logger.Info("server started")
 
 	<-done
@@ -100,9 +226,11 @@ func (svc *service) listenAndShutdown(server *http.Server) error {
 	ctx, cancel := context.WithTimeout(context.Background(), gracefulPeriod)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		err = fmt.Errorf("server shutdown failed, %w", err)
-		return err
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			err = fmt.Errorf("server shutdown failed, %w", err)
+			return err
+		}
 	}
 
 	svc.logger.Info("server exited properly")
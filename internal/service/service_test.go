@@ -0,0 +1,234 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a buffer safe for concurrent use, capturing the logs of servers under test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func Test_service_makeServers(t *testing.T) {
+	newAPI := func(tt *testing.T, name, host string, port, tlsPort int, h2c bool) *service {
+		return &service{
+			cfg: &config{
+				name:        name,
+				host:        host,
+				port:        port,
+				h2c:         h2c,
+				tlsPort:     tlsPort,
+				tlsAutoCert: tlsPort != 0,
+				tlsCertDir:  tt.TempDir(),
+				tlsHosts:    []string{host},
+			},
+			logger: newStructuredLogger(slog.LevelDebug),
+		}
+	}
+
+	type server struct {
+		addr        string
+		tlsCerts    int
+		unencrypted bool
+	}
+	tests := []struct {
+		name    string
+		apis    func(tt *testing.T) []*service
+		want    []server
+		wantErr bool
+	}{
+		{
+			name: "single API",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", "", 8080, 0, true)}
+			},
+			want: []server{{addr: ":8080", unencrypted: true}},
+		},
+		{
+			name: "APIs on different ports",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", "users.test", 8081, 0, false), newAPI(tt, "orders", "orders.test", 8082, 0, false)}
+			},
+			want: []server{{addr: ":8081"}, {addr: ":8082"}},
+		},
+		{
+			name: "APIs sharing plain and TLS ports",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", "users.test", 8080, 8443, false), newAPI(tt, "orders", "orders.test", 8080, 8443, true)}
+			},
+			want: []server{{addr: ":8080", unencrypted: true}, {addr: ":8443", tlsCerts: 2}},
+		},
+		{
+			name: "port used for both HTTP and HTTPS",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", "users.test", 8080, 8443, false), newAPI(tt, "orders", "orders.test", 8443, 0, false)}
+			},
+			wantErr: true,
+		},
+		{
+			name: "TLS port shared with different client certificate settings",
+			apis: func(tt *testing.T) []*service {
+				users, orders := newAPI(tt, "users", "users.test", 8080, 8443, false), newAPI(tt, "orders", "orders.test", 8080, 8443, false)
+				caPEM, _ := newClientCert(tt, "client-1", "client-1@partner.test")
+				caFile := filepath.Join(tt.TempDir(), "client-ca.crt")
+				if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+					tt.Fatal(err)
+				}
+				users.cfg.tlsClientCAFile, users.cfg.tlsClientAuth = caFile, clientAuthRequire
+				return []*service{users, orders}
+			},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			svc := &service{apis: test.apis(tt), logger: newStructuredLogger(slog.LevelDebug)}
+			got, err := svc.makeServers()
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("makeServers() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(got) != len(test.want) {
+				tt.Fatalf("makeServers() returned %d servers, want %d", len(got), len(test.want))
+			}
+			for i, srv := range got {
+				want := test.want[i]
+				if srv.Addr != want.addr {
+					tt.Errorf("server %d: expected address %s, got %s", i, want.addr, srv.Addr)
+				}
+				if srv.Protocols.UnencryptedHTTP2() != want.unencrypted {
+					tt.Errorf("server %d: expected h2c %v, got %v", i, want.unencrypted, srv.Protocols.UnencryptedHTTP2())
+				}
+				if (srv.TLSConfig != nil) != (want.tlsCerts > 0) {
+					tt.Fatalf("server %d: unexpected TLS configuration %v", i, srv.TLSConfig)
+				}
+				if srv.TLSConfig != nil && len(srv.TLSConfig.Certificates) != want.tlsCerts {
+					tt.Errorf("server %d: expected %d certificates, got %d", i, want.tlsCerts, len(srv.TLSConfig.Certificates))
+				}
+			}
+		})
+	}
+}
+
+func Test_service_makeServers_http2(t *testing.T) {
+	logs := &syncBuffer{}
+	svc := &service{
+		cfg: &config{
+			port:            8080,
+			uriPrefix:       "/v1/mock",
+			methods:         []string{http.MethodGet},
+			subRoutes:       []string{"/"},
+			successCode:     http.StatusOK,
+			successRespBody: json.RawMessage(`{"proto": "{{.Proto}}"}`),
+			successRatio:    1.0,
+			rateLimit:       1000,
+			h2c:             true,
+			tlsPort:         8443,
+			tlsAutoCert:     true,
+			tlsCertDir:      t.TempDir(),
+			tlsHosts:        []string{"127.0.0.1"},
+		},
+		reqCounter: 1,
+		logger:     slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	svc.makeRouter()
+	servers, err := svc.makeServers()
+	if err != nil {
+		t.Fatalf("makeServers() error = %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("makeServers() returned %d servers, want 2", len(servers))
+	}
+
+	serverCA, err := os.ReadFile(filepath.Join(svc.cfg.tlsCertDir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverCA)
+	h2c, h2 := new(http.Protocols), new(http.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+	h2.SetHTTP2(true)
+
+	tests := []struct {
+		name      string
+		server    *http.Server
+		scheme    string
+		transport *http.Transport
+	}{
+		{
+			name:      "h2c (prior knowledge) on the plain port",
+			server:    servers[0],
+			scheme:    "http",
+			transport: &http.Transport{Protocols: h2c},
+		},
+		{
+			name:      "HTTP/2 over TLS",
+			server:    servers[1],
+			scheme:    "https",
+			transport: &http.Transport{Protocols: h2, TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if test.server.TLSConfig != nil {
+				go func() { _ = test.server.ServeTLS(listener, "", "") }()
+			} else {
+				go func() { _ = test.server.Serve(listener) }()
+			}
+			tt.Cleanup(func() { _ = test.server.Close() })
+
+			client := &http.Client{Transport: test.transport}
+			resp, err := client.Get(test.scheme + "://" + listener.Addr().String() + "/v1/mock/")
+			if err != nil {
+				tt.Fatalf("request error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.ProtoMajor != 2 {
+				tt.Errorf("expected HTTP/2, got %s", resp.Proto)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(body)); got != `{"proto":"HTTP/2.0"}` {
+				tt.Errorf("expected the protocol in the body, got %s", got)
+			}
+			if !strings.Contains(logs.String(), test.scheme+"://"+listener.Addr().String()+"/v1/mock/ HTTP/2.0") {
+				tt.Errorf("expected the protocol in the request logs, got %s", logs.String())
+			}
+		})
+	}
+}
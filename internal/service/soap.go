@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+
+	"github.com/juan131/api-mock/pkg/api"
+)
+
+// SOAP versions and their envelope namespaces and content types
+const (
+	soap11 = "1.1"
+	soap12 = "1.2"
+
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+
+	soap11ContentType = "text/xml; charset=utf-8"
+	soap12ContentType = "application/soap+xml; charset=utf-8"
+)
+
+// soap is the definition of a SOAP route
+type soap struct {
+	Version    string            `json:"version"`    // SOAP version (1.1 or 1.2, defaults to 1.1)
+	Namespaces map[string]string `json:"namespaces"` // namespace prefixes available to XPath predicates
+	Operations []soapOperation   `json:"operations"` // operations (the first matching one is used)
+	Failure    *soapFault        `json:"failure"`    // fault returned by failed requests
+}
+
+// soapOperation is a SOAP operation, matched by action and XPath predicates over the request
+type soapOperation struct {
+	Action   string        `json:"action"`   // SOAP action (any if empty)
+	Match    []string      `json:"match"`    // XPath predicates the request envelope must satisfy
+	Response string        `json:"response"` // XML content of the response body, wrapped in an envelope
+	Fault    *soapFault    `json:"fault"`    // fault returned instead of a response
+	match    []*xpath.Expr // compiled XPath predicates
+}
+
+// soapFault is a SOAP fault
+type soapFault struct {
+	Code   string `json:"code"`   // fault code: Client/Sender or Server/Receiver (defaults to Server)
+	String string `json:"string"` // fault string (reason)
+	Detail string `json:"detail"` // XML content of the fault detail
+}
+
+// validate checks the SOAP route definition, compiling its XPath predicates
+func (s *soap) validate() error {
+	if s.Version == "" {
+		s.Version = soap11
+	}
+	if s.Version != soap11 && s.Version != soap12 {
+		return fmt.Errorf("invalid version %q", s.Version)
+	}
+	if len(s.Operations) == 0 {
+		return errors.New("at least one operation is required")
+	}
+
+	for i := range s.Operations {
+		op := &s.Operations[i]
+		if (op.Response == "") == (op.Fault == nil) {
+			return fmt.Errorf("operation %d: one of response or fault is required", i)
+		}
+		for _, predicate := range op.Match {
+			expr, err := xpath.CompileWithNS(predicate, s.Namespaces)
+			if err != nil {
+				return fmt.Errorf("operation %d: invalid xpath %q: %w", i, predicate, err)
+			}
+			op.match = append(op.match, expr)
+		}
+		if op.Response != "" {
+			if err := validateXMLContent(op.Response); err != nil {
+				return fmt.Errorf("operation %d: invalid response: %w", i, err)
+			}
+		}
+		if op.Fault != nil {
+			if err := op.Fault.validate(); err != nil {
+				return fmt.Errorf("operation %d: invalid fault: %w", i, err)
+			}
+		}
+	}
+
+	if s.Failure != nil {
+		if err := s.Failure.validate(); err != nil {
+			return fmt.Errorf("invalid failure: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the fault definition, setting its defaults
+func (f *soapFault) validate() error {
+	switch f.Code {
+	case "":
+		f.Code = "Server"
+	case "Client", "Sender", "Server", "Receiver":
+	default:
+		return fmt.Errorf("invalid fault code %q", f.Code)
+	}
+	if f.String == "" {
+		return errors.New("fault string is required")
+	}
+
+	return validateXMLContent(f.Detail)
+}
+
+// validateXMLContent checks an XML content is well-formed, unless it's a template
+func validateXMLContent(content string) error {
+	if isTemplate([]byte(content)) {
+		_, err := parseTemplate(content, nil)
+		return err
+	}
+
+	dec := xml.NewDecoder(strings.NewReader("<content>" + content + "</content>"))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// handleSOAP mocks the response of a SOAP route, replying with the
+// first operation matching the request action and XML envelope
+func (svc *service) handleSOAP(w http.ResponseWriter, r *http.Request, s *soap) {
+	body, err := readBody(w, r, maxBodySize)
+	if err != nil {
+		svc.renderBodyReadingError(w, r, "handleSOAP", err)
+		return
+	}
+
+	doc, err := xmlquery.Parse(bytes.NewReader(body))
+	if err != nil {
+		svc.LogRequestFailure(r, "[handleSOAP] invalid xml body", err)
+		svc.renderSOAPFault(w, r, s, &soapFault{Code: "Client", String: "invalid xml body"})
+		return
+	}
+
+	op := s.match(soapAction(r), doc)
+	if op == nil {
+		svc.LogRequestFailure(r, "[handleSOAP] no matching operation for action "+soapAction(r), nil)
+		svc.renderSOAPFault(w, r, s, &soapFault{Code: "Client", String: "no matching operation"})
+		return
+	}
+
+	svc.mockResponse(w, r, func(w http.ResponseWriter, r *http.Request) {
+		if op.Fault != nil {
+			svc.renderSOAPFault(w, r, s, op.Fault)
+			return
+		}
+		svc.renderSOAP(w, r, s, svc.cfg.successCode, op.Response)
+	}, func(w http.ResponseWriter, r *http.Request) {
+		fault := s.Failure
+		if fault == nil {
+			logID := svc.LogRequestFailure(r, "[handleSOAP] failed request", nil)
+			fault = &soapFault{Code: "Server", String: "failed request", Detail: fmt.Sprintf("<code>%d</code><id>%s</id>", api.CodeFailedRequest, logID)}
+		}
+		svc.renderSOAPFault(w, r, s, fault)
+	})
+}
+
+// match returns the first operation matching the action and the request envelope, or nil if none does
+func (s *soap) match(action string, doc *xmlquery.Node) *soapOperation {
+	for i := range s.Operations {
+		op := &s.Operations[i]
+		if op.Action != "" && op.Action != action {
+			continue
+		}
+		matches := true
+		for _, expr := range op.match {
+			if !xpathTrue(expr.Evaluate(xmlquery.CreateXPathNavigator(doc))) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return op
+		}
+	}
+
+	return nil
+}
+
+// xpathTrue converts the result of an XPath expression to a boolean, as the XPath boolean() function does
+func xpathTrue(result interface{}) bool {
+	switch v := result.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case *xpath.NodeIterator:
+		return v.MoveNext()
+	default:
+		return false
+	}
+}
+
+// soapAction returns the action of a SOAP request, set either in the SOAPAction
+// header (SOAP 1.1) or as the action parameter of the content type (SOAP 1.2)
+func soapAction(r *http.Request) string {
+	if action := r.Header.Get("SOAPAction"); action != "" {
+		return strings.Trim(action, `"`)
+	}
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return params["action"]
+}
+
+// renderSOAPFault renders the template (if any) of the fault and writes it as response
+func (svc *service) renderSOAPFault(w http.ResponseWriter, r *http.Request, s *soap, f *soapFault) {
+	code := s.faultCode(f.Code)
+	status := http.StatusInternalServerError
+	if code == "Sender" {
+		status = http.StatusBadRequest
+	}
+
+	reason := &bytes.Buffer{}
+	_ = xml.EscapeText(reason, []byte(f.String))
+	var fault string
+	if s.Version == soap12 {
+		fault = fmt.Sprintf(`<soap:Fault><soap:Code><soap:Value>soap:%s</soap:Value></soap:Code><soap:Reason><soap:Text xml:lang="en">%s</soap:Text></soap:Reason>`, code, reason)
+		if f.Detail != "" {
+			fault += "<soap:Detail>" + f.Detail + "</soap:Detail>"
+		}
+	} else {
+		fault = fmt.Sprintf(`<soap:Fault><faultcode>soap:%s</faultcode><faultstring>%s</faultstring>`, code, reason)
+		if f.Detail != "" {
+			fault += "<detail>" + f.Detail + "</detail>"
+		}
+	}
+
+	svc.renderSOAP(w, r, s, status, fault+"</soap:Fault>")
+}
+
+// faultCode returns the fault code for the route's SOAP version, as
+// Client and Server were renamed to Sender and Receiver in SOAP 1.2
+func (s *soap) faultCode(code string) string {
+	renamed := map[string]string{"Sender": "Client", "Receiver": "Server"}
+	if s.Version == soap12 {
+		renamed = map[string]string{"Client": "Sender", "Server": "Receiver"}
+	}
+	if c, found := renamed[code]; found {
+		return c
+	}
+
+	return code
+}
+
+// renderSOAP renders the body content template (if any) and writes it wrapped in an envelope
+func (svc *service) renderSOAP(w http.ResponseWriter, r *http.Request, s *soap, status int, content string) {
+	rendered, err := svc.renderBody(r, []byte(content))
+	if err != nil {
+		svc.renderTemplateError(w, r, err)
+		return
+	}
+
+	namespace, contentType := soap11Namespace, soap11ContentType
+	if s.Version == soap12 {
+		namespace, contentType = soap12Namespace, soap12ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><soap:Envelope xmlns:soap="%s"><soap:Body>%s</soap:Body></soap:Envelope>`, namespace, rendered)
+}
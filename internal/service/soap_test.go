@@ -0,0 +1,212 @@
+package service
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSOAPEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:pay="urn:payments">
+  <soapenv:Body>
+    <pay:Charge>
+      <pay:Amount>%s</pay:Amount>
+      <pay:Currency>EUR</pay:Currency>
+    </pay:Charge>
+  </soapenv:Body>
+</soapenv:Envelope>`
+
+func Test_service_handleSOAP(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         string
+		action          string
+		contentType     string
+		body            string
+		ratio           float64
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "operation matched by action and xpath",
+			action:          `"urn:Charge"`,
+			body:            strings.Replace(testSOAPEnvelope, "%s", "50", 1),
+			wantCode:        http.StatusOK,
+			wantContentType: soap11ContentType,
+			wantBody:        `<soap:Body><pay:ChargeResponse xmlns:pay="urn:payments"><pay:Status>APPROVED</pay:Status><pay:Method>POST</pay:Method></pay:ChargeResponse></soap:Body>`,
+		},
+		{
+			name:            "operation replying with a fault",
+			action:          "urn:Charge",
+			body:            strings.Replace(testSOAPEnvelope, "%s", "5000", 1),
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: soap11ContentType,
+			wantBody:        `<soap:Fault><faultcode>soap:Client</faultcode><faultstring>amount &gt; limit</faultstring><detail><code>LIMIT</code></detail></soap:Fault>`,
+		},
+		{
+			name:            "SOAP 1.2 action in the content type",
+			version:         soap12,
+			contentType:     `application/soap+xml; charset=utf-8; action="urn:Charge"`,
+			body:            strings.Replace(testSOAPEnvelope, "%s", "5000", 1),
+			wantCode:        http.StatusBadRequest,
+			wantContentType: soap12ContentType,
+			wantBody:        `<soap:Fault><soap:Code><soap:Value>soap:Sender</soap:Value></soap:Code><soap:Reason><soap:Text xml:lang="en">amount &gt; limit</soap:Text></soap:Reason><soap:Detail><code>LIMIT</code></soap:Detail></soap:Fault>`,
+		},
+		{
+			name:            "no matching operation",
+			action:          "urn:Refund",
+			body:            strings.Replace(testSOAPEnvelope, "%s", "50", 1),
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: soap11ContentType,
+			wantBody:        `<faultstring>no matching operation</faultstring>`,
+		},
+		{
+			name:            "invalid xml body",
+			action:          "urn:Charge",
+			body:            `<soapenv:Envelope>`,
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: soap11ContentType,
+			wantBody:        `<faultcode>soap:Client</faultcode><faultstring>invalid xml body</faultstring>`,
+		},
+		{
+			name:            "failure injection",
+			action:          "urn:Charge",
+			body:            strings.Replace(testSOAPEnvelope, "%s", "50", 1),
+			ratio:           0.5,
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: soap11ContentType,
+			wantBody:        `<faultcode>soap:Server</faultcode><faultstring>payment provider unavailable</faultstring>`,
+		},
+		{
+			name:            "body larger than its limit",
+			action:          `"urn:Charge"`,
+			body:            strings.Replace(testSOAPEnvelope, "%s", strings.Repeat("5", int(maxBodySize)), 1),
+			wantCode:        http.StatusRequestEntityTooLarge,
+			wantContentType: "application/json",
+			wantBody:        "body too large",
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{
+				Path: "/payments",
+				SOAP: &soap{
+					Version:    test.version,
+					Namespaces: map[string]string{"pay": "urn:payments"},
+					Operations: []soapOperation{
+						{
+							Action: "urn:Charge",
+							Match:  []string{"//pay:Amount > 1000"},
+							Fault:  &soapFault{Code: "Client", String: "amount > limit", Detail: "<code>LIMIT</code>"},
+						},
+						{
+							Action:   "urn:Charge",
+							Match:    []string{"//pay:Currency = 'EUR'"},
+							Response: `<pay:ChargeResponse xmlns:pay="urn:payments"><pay:Status>APPROVED</pay:Status><pay:Method>{{.Method}}</pay:Method></pay:ChargeResponse>`,
+						},
+					},
+					Failure: &soapFault{String: "payment provider unavailable"},
+				},
+			}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			ratio := 1.0
+			if test.ratio != 0 {
+				ratio = test.ratio
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					successCode:  http.StatusOK,
+					successRatio: ratio,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/mock/payments", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", soap11ContentType)
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			if test.action != "" {
+				req.Header.Set("SOAPAction", test.action)
+			}
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if w.Code != test.wantCode {
+				tt.Errorf("expected status code %d, got %d (%s)", test.wantCode, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != test.wantContentType {
+				tt.Errorf("expected content type %s, got %s", test.wantContentType, got)
+			}
+			if got := w.Body.String(); !strings.Contains(got, test.wantBody) {
+				tt.Errorf("expected body containing %s, got %s", test.wantBody, got)
+			}
+		})
+	}
+}
+
+func Test_soap_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		soap    soap
+		wantErr bool
+	}{
+		{
+			name: "valid definition",
+			soap: soap{Operations: []soapOperation{{Action: "urn:Charge", Match: []string{"//Amount > 10"}, Response: "<ChargeResponse/>"}}},
+		},
+		{
+			name:    "invalid version",
+			soap:    soap{Version: "2.0", Operations: []soapOperation{{Response: "<ChargeResponse/>"}}},
+			wantErr: true,
+		},
+		{
+			name:    "no operations",
+			soap:    soap{},
+			wantErr: true,
+		},
+		{
+			name:    "both response and fault",
+			soap:    soap{Operations: []soapOperation{{Response: "<ChargeResponse/>", Fault: &soapFault{String: "declined"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid xpath",
+			soap:    soap{Operations: []soapOperation{{Match: []string{"//Amount["}, Response: "<ChargeResponse/>"}}},
+			wantErr: true,
+		},
+		{
+			name:    "malformed response",
+			soap:    soap{Operations: []soapOperation{{Response: "<ChargeResponse>"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid fault code",
+			soap:    soap{Operations: []soapOperation{{Fault: &soapFault{Code: "Unknown", String: "declined"}}}},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if err := test.soap.validate(); (err != nil) != test.wantErr {
+				tt.Errorf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
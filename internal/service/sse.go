@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sse is the definition of a Server-Sent Events route
+type sse struct {
+	Events []sseEvent `json:"events"` // events streamed to clients
+	Loop   bool       `json:"loop"`   // whether to stream the events again once all of them are sent
+}
+
+// sseEvent is an event streamed to clients
+type sseEvent struct {
+	ID      string          `json:"id"`    // event id, used by clients to resume the stream
+	Event   string          `json:"event"` // event type
+	Data    json.RawMessage `json:"data"`  // any JSON value, strings are sent as is
+	Retry   int             `json:"retry"` // reconnection time sent to clients (in milliseconds)
+	Delay   int             `json:"delay"` // delay before sending the event (in milliseconds)
+	payload []byte          // raw data sent to clients
+}
+
+// validate checks the Server-Sent Events route definition, preparing its events data
+func (s *sse) validate() error {
+	if len(s.Events) == 0 {
+		return errors.New("at least one event is required")
+	}
+
+	loopDelay := 0
+	for i := range s.Events {
+		if err := s.Events[i].validate(); err != nil {
+			return fmt.Errorf("event %d: %w", i, err)
+		}
+		loopDelay += s.Events[i].Delay
+	}
+	if s.Loop && loopDelay == 0 {
+		return errors.New("looping events require a delay")
+	}
+
+	return nil
+}
+
+// validate checks the event fields, preparing the data sent to clients
+func (e *sseEvent) validate() error {
+	if e.Delay < 0 || e.Retry < 0 {
+		return errors.New("delay and retry can't be negative")
+	}
+	if strings.ContainsAny(e.ID+e.Event, "\r\n") {
+		return errors.New("id and event can't contain line breaks")
+	}
+
+	var text string
+	switch {
+	case len(e.Data) == 0:
+		e.payload = nil
+	case json.Unmarshal(e.Data, &text) == nil:
+		e.payload = []byte(text)
+	default:
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, e.Data); err != nil {
+			return err
+		}
+		e.payload = buf.Bytes()
+	}
+
+	if isTemplate(e.payload) {
+		if _, err := parseTemplate(string(e.payload), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serveSSE returns a handler streaming the events of a Server-Sent Events route. Clients
+// reconnecting with the Last-Event-ID header resume the stream after the given event.
+func (svc *service) serveSSE(s *sse) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			svc.LogRequestFailure(r, "[serveSSE] streaming not supported", err)
+			return
+		}
+
+		next := 0
+		if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+			for i, e := range s.Events {
+				if e.ID == lastEventID {
+					next = i + 1
+					break
+				}
+			}
+		}
+		if next == len(s.Events) && !s.Loop {
+			// all the events were already received
+			return
+		}
+
+		data := svc.newTemplateData(r)
+		for ; s.Loop || next < len(s.Events); next++ {
+			if next == len(s.Events) {
+				next = 0
+			}
+			e := &s.Events[next]
+			if e.Delay > 0 {
+				timer := time.NewTimer(time.Duration(e.Delay) * time.Millisecond)
+				select {
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+
+			payload, err := svc.renderTemplate(e.payload, data)
+			if err != nil {
+				svc.LogRequestFailure(r, "[serveSSE] event template", err)
+				return
+			}
+			if _, err = w.Write(e.format(payload)); err != nil {
+				return
+			}
+			if err = rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// format returns the event in the text/event-stream format with the given data
+func (e *sseEvent) format(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	if e.ID != "" {
+		fmt.Fprintf(buf, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(buf, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(buf, "retry: %d\n", e.Retry)
+	}
+	if data != nil {
+		for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+			fmt.Fprintf(buf, "data: %s\n", line)
+		}
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes()
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_service_serveSSE(t *testing.T) {
+	definition := `{"events": [
+		{"id": "1", "event": "created", "data": {"id": 1}, "retry": 3000},
+		{"id": "2", "data": "line 1\nline 2", "delay": 10},
+		{"id": "3", "event": "path", "data": "{{.Path}}"}
+	]}`
+	tests := []struct {
+		name        string
+		definition  string
+		lastEventID string
+		maxLines    int
+		want        string
+	}{
+		{
+			name:       "all events",
+			definition: definition,
+			want: "id: 1\nevent: created\nretry: 3000\ndata: {\"id\":1}\n\n" +
+				"id: 2\ndata: line 1\ndata: line 2\n\n" +
+				"id: 3\nevent: path\ndata: /v1/mock/events\n\n",
+		},
+		{
+			name:        "resume after the last event id",
+			definition:  definition,
+			lastEventID: "2",
+			want:        "id: 3\nevent: path\ndata: /v1/mock/events\n\n",
+		},
+		{
+			name:        "resume after the last event",
+			definition:  definition,
+			lastEventID: "3",
+			want:        "",
+		},
+		{
+			name:        "unknown last event id",
+			definition:  `{"events": [{"id": "1", "data": "foo"}]}`,
+			lastEventID: "42",
+			want:        "id: 1\ndata: foo\n\n",
+		},
+		{
+			name:        "looping events",
+			definition:  `{"events": [{"id": "1", "data": "foo", "delay": 1}, {"id": "2", "data": "bar", "delay": 1}], "loop": true}`,
+			lastEventID: "1",
+			maxLines:    9,
+			want:        "id: 2\ndata: bar\n\nid: 1\ndata: foo\n\nid: 2\ndata: bar\n\n",
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{Path: "/events"}
+			if err := json.Unmarshal([]byte(test.definition), &rt.SSE); err != nil {
+				tt.Fatal(err)
+			}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					successRatio: 1.0,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+			server := httptest.NewServer(svc.router)
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/mock/events", nil)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			if test.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", test.lastEventID)
+			}
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+				tt.Errorf("expected content type text/event-stream, got %s", ct)
+			}
+
+			var got string
+			if test.maxLines > 0 {
+				reader := bufio.NewReader(resp.Body)
+				for i := 0; i < test.maxLines; i++ {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						tt.Fatal(err)
+					}
+					got += line
+				}
+			} else {
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					tt.Fatal(err)
+				}
+				got = string(body)
+			}
+			if got != test.want {
+				tt.Errorf("expected events %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func Test_sse_validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		wantErr    bool
+	}{
+		{
+			name:       "valid events",
+			definition: `{"events": [{"id": "1", "data": {"id": 1}, "delay": 100}], "loop": true}`,
+		},
+		{
+			name:       "no events",
+			definition: `{"events": []}`,
+			wantErr:    true,
+		},
+		{
+			name:       "looping events without delay",
+			definition: `{"events": [{"id": "1", "data": "foo"}], "loop": true}`,
+			wantErr:    true,
+		},
+		{
+			name:       "line break in the event type",
+			definition: `{"events": [{"event": "foo\nbar", "data": "foo"}]}`,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid template",
+			definition: `{"events": [{"data": "{{unknownFunc}}"}]}`,
+			wantErr:    true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			var s sse
+			if err := json.NewDecoder(strings.NewReader(test.definition)).Decode(&s); err != nil {
+				tt.Fatal(err)
+			}
+			if err := s.validate(); (err != nil) != test.wantErr {
+				tt.Errorf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
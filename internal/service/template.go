@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/juan131/api-mock/pkg/authn"
+	"github.com/juan131/api-mock/pkg/fake"
+)
+
+// default time window used to generate fake dates
+var (
+	defaultDateFrom = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	defaultDateTo   = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// templateData is the data available to response body templates
+type templateData struct {
+	Method   string                 // request method
+	Proto    string                 // request protocol (e.g. HTTP/2.0)
+	Path     string                 // request path
+	Params   map[string]string      // path parameters captured by the route
+	Query    url.Values             // request query parameters
+	Headers  http.Header            // request headers
+	Identity string                 // client identity (mutual TLS)
+	Claims   map[string]interface{} // claims of the JWT authenticating the request
+	Message  string                 // incoming message being replied (WebSocket routes) or event payload (long-polling routes)
+	Args     interface{}            // field arguments (GraphQL routes), request message (gRPC methods) or params (JSON-RPC routes)
+}
+
+// newTemplateData returns the template data for a given request
+func (svc *service) newTemplateData(r *http.Request) templateData {
+	return templateData{
+		Method:   r.Method,
+		Proto:    r.Proto,
+		Path:     r.URL.Path,
+		Params:   pathParams(r),
+		Query:    r.URL.Query(),
+		Headers:  r.Header,
+		Identity: svc.clientIdentity(r),
+		Claims:   authn.Claims(r),
+	}
+}
+
+// isTemplate returns true if the body contains template actions
+func isTemplate(body []byte) bool {
+	return bytes.Contains(body, []byte("{{"))
+}
+
+// parseJSONTemplate returns the template of a JSON body (any JSON value, or a JSON string holding a template)
+func parseJSONTemplate(body json.RawMessage) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	// a JSON string holding a template is used as the whole template
+	var text string
+	if json.Unmarshal(body, &text) == nil && isTemplate([]byte(text)) {
+		body = []byte(text)
+	}
+	if isTemplate(body) {
+		if _, err := parseTemplate(string(body), nil); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		return body, nil
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("invalid json")
+	}
+
+	return body, nil
+}
+
+// parseTemplate parses a response body template whose
+// fake data functions are backed by the given generator
+func parseTemplate(body string, g *fake.Generator) (*template.Template, error) {
+	return template.New("body").Option("missingkey=zero").Funcs(templateFuncs(g)).Parse(body)
+}
+
+// escapeTemplate escapes the template actions delimiters of a body, so it's rendered as is
+func escapeTemplate(body []byte) []byte {
+	return bytes.ReplaceAll(body, []byte("{{"), []byte(`{{"{{"}}`))
+}
+
+// parseRespBody parses a response body, which must be either a JSON value or, if templated
+// bodies are enabled, a template rendering a JSON value. Template delimiters in JSON values
+// are escaped otherwise, so bodies holding them are served as is.
+func parseRespBody(value string, templated bool) (json.RawMessage, error) {
+	if templated && isTemplate([]byte(value)) {
+		if _, err := parseTemplate(value, nil); err != nil {
+			return nil, err
+		}
+		return json.RawMessage(value), nil
+	}
+
+	var body json.RawMessage
+	if err := json.Unmarshal([]byte(value), &body); err != nil {
+		return nil, err
+	}
+
+	return escapeTemplate(body), nil
+}
+
+// fakeGenerator returns the service's fake data generator
+func (svc *service) fakeGenerator() *fake.Generator {
+	svc.fakeOnce.Do(func() {
+		seed := time.Now().UnixNano()
+		if svc.cfg.fakeSeed != nil {
+			seed = *svc.cfg.fakeSeed
+		}
+		svc.fake = fake.New(seed)
+	})
+
+	return svc.fake
+}
+
+// renderBody renders the body template (if any) for the given request
+func (svc *service) renderBody(r *http.Request, body []byte) ([]byte, error) {
+	return svc.renderTemplate(body, svc.newTemplateData(r))
+}
+
+// renderTemplate renders the body template (if any) with the given data
+func (svc *service) renderTemplate(body []byte, data templateData) ([]byte, error) {
+	if !isTemplate(body) {
+		return body, nil
+	}
+
+	tmpl, err := svc.template(body)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// template returns the parsed body template, templates being parsed once and reused afterwards
+func (svc *service) template(body []byte) (*template.Template, error) {
+	if tmpl, found := svc.templates.Load(string(body)); found {
+		return tmpl.(*template.Template), nil
+	}
+
+	tmpl, err := parseTemplate(string(body), svc.fakeGenerator())
+	if err != nil {
+		return nil, err
+	}
+	cached, _ := svc.templates.LoadOrStore(string(body), tmpl)
+
+	return cached.(*template.Template), nil
+}
+
+// renderJSONBody renders the JSON body template (if any) for the given request
+func (svc *service) renderJSONBody(r *http.Request, body json.RawMessage) (json.RawMessage, error) {
+	rendered, err := svc.renderBody(r, body)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(rendered) {
+		return nil, fmt.Errorf("rendered body is not valid json: %s", rendered)
+	}
+
+	return rendered, nil
+}
+
+// templateFuncs returns the functions available to response body templates
+func templateFuncs(g *fake.Generator) template.FuncMap {
+	return template.FuncMap{
+		// Fake data
+		"uuid":      g.UUID,
+		"name":      g.Name,
+		"firstName": g.FirstName,
+		"lastName":  g.LastName,
+		"username":  g.Username,
+		"email":     g.Email,
+		"phone":     g.Phone,
+		"company":   g.Company,
+		"street":    g.Street,
+		"city":      g.City,
+		"country":   g.Country,
+		"zipCode":   g.ZipCode,
+		"address":   g.Address,
+		"word":      g.Word,
+		"words":     g.Words,
+		"sentence":  g.Sentence,
+		"paragraph": g.Paragraph,
+		"int":       g.Int,
+		"bool":      g.Bool,
+		"pick":      g.Pick,
+		"float": func(low, high float64) float64 {
+			return math.Round(g.Float(low, high)*100) / 100
+		},
+		"date": func(bounds ...string) (string, error) {
+			t, err := fakeTime(g, bounds)
+			return t.Format(time.DateOnly), err
+		},
+		"dateTime": func(bounds ...string) (string, error) {
+			t, err := fakeTime(g, bounds)
+			return t.Format(time.RFC3339), err
+		},
+		// Helpers
+		"now": func() string {
+			return time.Now().UTC().Format(time.RFC3339)
+		},
+		"seq": func(n int) []int {
+			s := []int{}
+			for i := 0; i < n; i++ {
+				s = append(s, i)
+			}
+			return s
+		},
+		"json": func(v interface{}) (string, error) {
+			buf, err := json.Marshal(v)
+			return string(buf), err
+		},
+	}
+}
+
+// fakeTime returns a random time between the given bounds (dates formatted as YYYY-MM-DD)
+// or within the default time window if no bounds are provided
+func fakeTime(g *fake.Generator, bounds []string) (time.Time, error) {
+	from, to := defaultDateFrom, defaultDateTo
+	switch len(bounds) {
+	case 0:
+	case 2:
+		var err error
+		if from, err = time.Parse(time.DateOnly, bounds[0]); err != nil {
+			return time.Time{}, err
+		}
+		if to, err = time.Parse(time.DateOnly, bounds[1]); err != nil {
+			return time.Time{}, err
+		}
+	default:
+		return time.Time{}, fmt.Errorf("expected 0 or 2 date bounds, got %d", len(bounds))
+	}
+
+	return g.Time(from, to), nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func Test_service_renderJSONBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		match   string
+		wantErr bool
+	}{
+		{
+			name:  "static body",
+			body:  `{"success": true}`,
+			match: `^\{"success": true\}$`,
+		},
+		{
+			name:  "fake data",
+			body:  `{"id": "{{uuid}}", "email": "{{email}}", "age": {{int 18 99}}, "joined": "{{date "2020-01-01" "2020-12-31"}}"}`,
+			match: `^\{"id": "[0-9a-f-]{36}", "email": "[a-z0-9.]+@[a-z.]+", "age": [0-9]{2}, "joined": "2020-[0-9]{2}-[0-9]{2}"\}$`,
+		},
+		{
+			name:  "list of items",
+			body:  `[{{range $i, $_ := seq 3}}{{if $i}},{{end}}{"id": {{$i}}}{{end}}]`,
+			match: `^\[\{"id": 0\},\{"id": 1\},\{"id": 2\}\]$`,
+		},
+		{
+			name:  "request data",
+			body:  `{"method": "{{.Method}}", "q": {{json (.Query.Get "q")}}}`,
+			match: `^\{"method": "GET", "q": "foo"\}$`,
+		},
+		{
+			name:  "escaped template delimiters",
+			body:  string(escapeTemplate([]byte(`{"pattern": "{{name}} {{"}`))),
+			match: `^\{"pattern": "\{\{name\}\} \{\{"\}$`,
+		},
+		{
+			name:    "rendered body is not valid JSON",
+			body:    `{"name": {{name}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid date bounds",
+			body:    `{"date": "{{date "yesterday"}}"}`,
+			wantErr: true,
+		},
+	}
+	seed := int64(42)
+	svc := &service{
+		cfg:    &config{fakeSeed: &seed},
+		logger: newStructuredLogger(slog.LevelDebug),
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/v1/mock/foo?q=foo", nil)
+			got, err := svc.renderJSONBody(req, json.RawMessage(test.body))
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("renderJSONBody() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && !regexp.MustCompile(test.match).Match(got) {
+				tt.Errorf("renderJSONBody() = %s, want match %s", got, test.match)
+			}
+		})
+	}
+}
+
+func Test_service_renderJSONBody_seed(t *testing.T) {
+	body := json.RawMessage(`{"name": "{{name}}", "address": "{{address}}", "price": {{float 1 100}}}`)
+	req := httptest.NewRequest(http.MethodGet, "/v1/mock/foo", nil)
+	seed := int64(1234)
+
+	var results []string
+	for i := 0; i < 2; i++ {
+		svc := &service{cfg: &config{fakeSeed: &seed}}
+		got, err := svc.renderJSONBody(req, body)
+		if err != nil {
+			t.Fatalf("renderJSONBody() error = %v", err)
+		}
+		results = append(results, string(got))
+	}
+
+	if results[0] != results[1] {
+		t.Errorf("expected the same output for the same seed, got %s and %s", results[0], results[1])
+	}
+}
+
+func Test_service_template(t *testing.T) {
+	svc := &service{cfg: &config{}}
+	body := []byte(`{"id": "{{uuid}}"}`)
+
+	first, err := svc.template(body)
+	if err != nil {
+		t.Fatalf("template() error = %v", err)
+	}
+	second, err := svc.template(body)
+	if err != nil {
+		t.Fatalf("template() error = %v", err)
+	}
+	if first != second {
+		t.Error("expected the template to be parsed once and reused")
+	}
+	if _, err = svc.template([]byte(`{{unknownFunc}}`)); err == nil {
+		t.Error("expected an error parsing an invalid template")
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/juan131/api-mock/pkg/certs"
+)
+
+// client certificates policies
+const (
+	clientAuthRequire  = "require"  // clients must present a valid certificate
+	clientAuthOptional = "optional" // client certificates are verified only if presented
+)
+
+// client certificate fields that can be mapped to the client identity
+const (
+	identityCommonName = "cn"      // subject common name
+	identitySubject    = "subject" // full subject distinguished name
+	identityDNS        = "dns"     // first DNS subject alternative name
+	identityEmail      = "email"   // first email subject alternative name
+	identityURI        = "uri"     // first URI subject alternative name (e.g. SPIFFE IDs)
+)
+
+// identityFields are the supported client identity mappings
+var identityFields = []string{identityCommonName, identitySubject, identityDNS, identityEmail, identityURI}
+
+// tlsConfig returns the TLS configuration for the TLS server,
+// generating a self-signed certificate if required
+func (svc *service) tlsConfig() (*tls.Config, error) {
+	certFile, keyFile := svc.cfg.tlsCertFile, svc.cfg.tlsKeyFile
+	if svc.cfg.tlsAutoCert {
+		var err error
+		certFile, keyFile, err = certs.EnsureSelfSigned(svc.cfg.tlsCertDir, svc.cfg.tlsHosts)
+		if err != nil {
+			return nil, fmt.Errorf("self-signed certificate generation failed: %w", err)
+		}
+		svc.logger.Info(fmt.Sprintf("using self-signed certificate for %s, clients must trust the CA at %s", svc.cfg.tlsHosts, filepath.Join(svc.cfg.tlsCertDir, certs.CAFile)))
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	// Mutual TLS
+	if svc.cfg.tlsClientCAFile != "" {
+		caPEM, err := os.ReadFile(svc.cfg.tlsClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("no valid certificates found in " + svc.cfg.tlsClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if svc.cfg.tlsClientAuth == clientAuthOptional {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// mergeTLSConfigs returns the TLS configuration for a server shared by several mock APIs.
+// The certificate presented to clients is selected based on SNI, while the client certificates
+// policy must be the same for all of them.
+func mergeTLSConfigs(apis []*service) (*tls.Config, error) {
+	var merged *tls.Config
+	for _, api := range apis {
+		tlsConfig, err := api.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", api.cfg.name, err)
+		}
+		if merged == nil {
+			merged = tlsConfig
+			continue
+		}
+		if api.cfg.tlsClientCAFile != apis[0].cfg.tlsClientCAFile || tlsConfig.ClientAuth != merged.ClientAuth {
+			return nil, fmt.Errorf("%s: client certificate settings differ from %s's", api.cfg.name, apis[0].cfg.name)
+		}
+		merged.Certificates = append(merged.Certificates, tlsConfig.Certificates...)
+	}
+
+	return merged, nil
+}
+
+// clientIdentity returns the identity of the client based on its verified
+// TLS certificate, or an empty string if no certificate was presented
+func (svc *service) clientIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	switch svc.cfg.tlsClientIdentity {
+	case identitySubject:
+		return cert.Subject.String()
+	case identityDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case identityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case identityURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+
+	return ""
+}
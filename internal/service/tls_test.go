@@ -0,0 +1,273 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newClientCert generates a CA and a client certificate signed by it,
+// returning the PEM encoded CA and the client key pair
+func newClientCert(t *testing.T, commonName, email string) ([]byte, tls.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: commonName, Organization: []string{"partner"}},
+		EmailAddresses: []string{email},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func Test_service_mutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, clientCert := newClientCert(t, "client-1", "client-1@partner.test")
+	caFile := filepath.Join(dir, "client-ca.crt")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, otherClientCert := newClientCert(t, "intruder", "intruder@partner.test")
+
+	tests := []struct {
+		name         string
+		clientAuth   string
+		identity     string
+		clientCert   *tls.Certificate
+		wantErr      bool
+		wantIdentity string
+	}{
+		{
+			name:         "valid client certificate",
+			clientAuth:   clientAuthRequire,
+			identity:     identityCommonName,
+			clientCert:   &clientCert,
+			wantIdentity: "client-1",
+		},
+		{
+			name:         "valid client certificate mapped by email",
+			clientAuth:   clientAuthRequire,
+			identity:     identityEmail,
+			clientCert:   &clientCert,
+			wantIdentity: "client-1@partner.test",
+		},
+		{
+			name:       "missing client certificate",
+			clientAuth: clientAuthRequire,
+			identity:   identityCommonName,
+			wantErr:    true,
+		},
+		{
+			name:       "client certificate signed by an unknown CA",
+			clientAuth: clientAuthRequire,
+			identity:   identityCommonName,
+			clientCert: &otherClientCert,
+			wantErr:    true,
+		},
+		{
+			name:         "optional client certificate",
+			clientAuth:   clientAuthOptional,
+			identity:     identityCommonName,
+			wantIdentity: "",
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			svc := &service{
+				cfg: &config{
+					successCode:       http.StatusOK,
+					successRespBody:   json.RawMessage(`{"identity": "{{.Identity}}"}`),
+					successRatio:      1.0,
+					tlsAutoCert:       true,
+					tlsCertDir:        tt.TempDir(),
+					tlsHosts:          []string{"127.0.0.1"},
+					tlsClientCAFile:   caFile,
+					tlsClientAuth:     test.clientAuth,
+					tlsClientIdentity: test.identity,
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			tlsConfig, err := svc.tlsConfig()
+			if err != nil {
+				tt.Fatalf("tlsConfig() error = %v", err)
+			}
+			server := httptest.NewUnstartedServer(http.HandlerFunc(svc.handleMock))
+			server.TLS = tlsConfig
+			server.StartTLS()
+			defer server.Close()
+
+			serverCA, err := os.ReadFile(filepath.Join(svc.cfg.tlsCertDir, "ca.crt"))
+			if err != nil {
+				tt.Fatal(err)
+			}
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(serverCA)
+			clientTLSConfig := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+			if test.clientCert != nil {
+				clientTLSConfig.Certificates = []tls.Certificate{*test.clientCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLSConfig}}
+
+			resp, err := client.Get(server.URL)
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("request error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				tt.Fatal(err)
+			}
+			var got map[string]string
+			if err = json.Unmarshal(body, &got); err != nil {
+				tt.Fatalf("could not unmarshal response body %s: %v", body, err)
+			}
+			if got["identity"] != test.wantIdentity {
+				tt.Errorf("expected identity %q, got %q", test.wantIdentity, got["identity"])
+			}
+		})
+	}
+}
+
+func Test_mergeTLSConfigs(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, _ := newClientCert(t, "client-1", "client-1@partner.test")
+	caFile := filepath.Join(dir, "client-ca.crt")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	newAPI := func(tt *testing.T, name, clientCAFile, clientAuth string) *service {
+		return &service{
+			cfg: &config{
+				name:            name,
+				tlsAutoCert:     true,
+				tlsCertDir:      tt.TempDir(),
+				tlsHosts:        []string{name + ".test"},
+				tlsClientCAFile: clientCAFile,
+				tlsClientAuth:   clientAuth,
+			},
+			logger: newStructuredLogger(slog.LevelDebug),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		apis           func(tt *testing.T) []*service
+		wantErr        bool
+		wantCerts      int
+		wantClientAuth tls.ClientAuthType
+	}{
+		{
+			name: "APIs without client certificates",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", "", ""), newAPI(tt, "orders", "", "")}
+			},
+			wantCerts:      2,
+			wantClientAuth: tls.NoClientCert,
+		},
+		{
+			name: "APIs requiring client certificates",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", caFile, clientAuthRequire), newAPI(tt, "orders", caFile, clientAuthRequire)}
+			},
+			wantCerts:      2,
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{
+			name: "API without client certificates after one requiring them",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", caFile, clientAuthRequire), newAPI(tt, "orders", "", "")}
+			},
+			wantErr: true,
+		},
+		{
+			name: "API requiring client certificates after one without them",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", "", ""), newAPI(tt, "orders", caFile, clientAuthRequire)}
+			},
+			wantErr: true,
+		},
+		{
+			name: "APIs with different client certificates policies",
+			apis: func(tt *testing.T) []*service {
+				return []*service{newAPI(tt, "users", caFile, clientAuthRequire), newAPI(tt, "orders", caFile, clientAuthOptional)}
+			},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			got, err := mergeTLSConfigs(test.apis(tt))
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("mergeTLSConfigs() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got.Certificates) != test.wantCerts {
+				tt.Errorf("expected %d certificates, got %d", test.wantCerts, len(got.Certificates))
+			}
+			if got.ClientAuth != test.wantClientAuth {
+				tt.Errorf("expected client auth %v, got %v", test.wantClientAuth, got.ClientAuth)
+			}
+		})
+	}
+}
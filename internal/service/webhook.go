@@ -0,0 +1,273 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // some webhook receivers still verify HMAC-SHA1 signatures
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	defaultWebhookRetryDelay = time.Second
+	maxWebhookRetries        = 10
+	webhookTimeout           = 10 * time.Second
+)
+
+// webhookTriggers are the outcomes of the requests triggering webhooks
+var webhookTriggers = []string{"success", "failure", "always"}
+
+// webhookHashes are the hash functions supported by webhook signatures
+var webhookHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// webhookClient is the HTTP client sending webhooks
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhook is an outgoing request sent after replying to the requests to a route
+type webhook struct {
+	URL        string            `json:"url"`        // callback URL
+	Method     string            `json:"method"`     // request method (defaults to POST)
+	Headers    map[string]string `json:"headers"`    // request headers
+	Body       json.RawMessage   `json:"body"`       // request body (any JSON value)
+	On         string            `json:"on"`         // outcome of the requests triggering the webhook: success (default), failure or always
+	Delay      int               `json:"delay"`      // delay before sending the webhook (in milliseconds)
+	Retries    int               `json:"retries"`    // number of retries on errors, 429 or 5xx responses
+	RetryDelay int               `json:"retryDelay"` // delay before the first retry, doubled on every retry (in milliseconds)
+	Signature  *webhookSignature `json:"signature"`  // HMAC signature of the body
+	body       []byte            // body template
+}
+
+// webhookSignature is the HMAC signature of a webhook body, sent as a header
+type webhookSignature struct {
+	Secret    string  `json:"secret"`    // HMAC secret
+	Algorithm string  `json:"algorithm"` // hash function: sha1, sha256 (default) or sha512
+	Header    string  `json:"header"`    // signature header (defaults to X-Signature)
+	Encoding  string  `json:"encoding"`  // signature encoding: hex (default) or base64
+	Prefix    *string `json:"prefix"`    // signature prefix (defaults to "<algorithm>=")
+}
+
+// validate checks the webhook definition and sets its defaults
+func (wh *webhook) validate() error {
+	if isTemplate([]byte(wh.URL)) {
+		if _, err := parseTemplate(wh.URL, nil); err != nil {
+			return fmt.Errorf("invalid url template: %w", err)
+		}
+	} else if u, err := url.Parse(wh.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", wh.URL)
+	}
+
+	if wh.Method == "" {
+		wh.Method = http.MethodPost
+	}
+	var err error
+	if wh.Method, err = parseMethod(wh.Method); err != nil {
+		return err
+	}
+	for key, value := range wh.Headers {
+		if _, err = parseTemplate(value, nil); err != nil {
+			return fmt.Errorf("invalid header %s template: %w", key, err)
+		}
+	}
+
+	if wh.body, err = parseJSONTemplate(wh.Body); err != nil {
+		return fmt.Errorf("invalid body: %w", err)
+	}
+	if len(wh.body) > 0 && !isTemplate(wh.body) {
+		buf := &bytes.Buffer{}
+		if err = json.Compact(buf, wh.body); err != nil {
+			return fmt.Errorf("invalid json body: %w", err)
+		}
+		wh.body = buf.Bytes()
+	}
+
+	if wh.On == "" {
+		wh.On = "success"
+	}
+	if !stringSliceContains(webhookTriggers, wh.On) {
+		return fmt.Errorf("invalid value for on: %s", wh.On)
+	}
+	if wh.Delay < 0 || wh.RetryDelay < 0 {
+		return errors.New("delays can't be negative")
+	}
+	if wh.Retries < 0 || wh.Retries > maxWebhookRetries {
+		return fmt.Errorf("retries must be between 0 and %d", maxWebhookRetries)
+	}
+
+	if wh.Signature != nil {
+		if err = wh.Signature.validate(); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the signature definition and sets its defaults
+func (sig *webhookSignature) validate() error {
+	if sig.Secret == "" {
+		return errors.New("secret is required")
+	}
+	if sig.Algorithm == "" {
+		sig.Algorithm = "sha256"
+	}
+	if webhookHashes[sig.Algorithm] == nil {
+		return fmt.Errorf("unsupported algorithm %s", sig.Algorithm)
+	}
+	if sig.Header == "" {
+		sig.Header = "X-Signature"
+	}
+	if sig.Encoding == "" {
+		sig.Encoding = "hex"
+	}
+	if sig.Encoding != "hex" && sig.Encoding != "base64" {
+		return fmt.Errorf("unsupported encoding %s", sig.Encoding)
+	}
+	if sig.Prefix == nil {
+		prefix := sig.Algorithm + "="
+		sig.Prefix = &prefix
+	}
+
+	return nil
+}
+
+// sign returns the signature of the body
+func (sig *webhookSignature) sign(body []byte) string {
+	mac := hmac.New(webhookHashes[sig.Algorithm], []byte(sig.Secret))
+	mac.Write(body)
+	if sig.Encoding == "base64" {
+		return *sig.Prefix + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	return *sig.Prefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// withWebhooks returns a handler triggering the route webhooks once the request is replied,
+// based on its outcome (success for 1xx-3xx status codes, failure otherwise)
+func (svc *service) withWebhooks(webhooks []webhook, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next(ww, r)
+
+		outcome := "success"
+		if ww.Status() >= http.StatusBadRequest {
+			outcome = "failure"
+		}
+		for i := range webhooks {
+			wh := &webhooks[i]
+			if wh.On != "always" && wh.On != outcome {
+				continue
+			}
+			req, err := svc.newWebhookRequest(r, wh)
+			if err != nil {
+				svc.LogRequestFailure(r, fmt.Sprintf("[withWebhooks] webhook %d template rendering error: %+v", i, err), err)
+				continue
+			}
+			go svc.sendWebhook(req, wh)
+		}
+	}
+}
+
+// newWebhookRequest returns the webhook request, rendering its templates for the incoming request
+func (svc *service) newWebhookRequest(r *http.Request, wh *webhook) (*webhookRequest, error) {
+	data := svc.newTemplateData(r)
+	target, err := svc.renderTemplate([]byte(wh.URL), data)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(string(target)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", target)
+	}
+
+	req := &webhookRequest{url: string(target), headers: http.Header{}}
+	for key, value := range wh.Headers {
+		rendered, err := svc.renderTemplate([]byte(value), data)
+		if err != nil {
+			return nil, err
+		}
+		req.headers.Set(key, string(rendered))
+	}
+	if wh.body != nil {
+		if req.body, err = svc.renderTemplate(wh.body, data); err != nil {
+			return nil, err
+		}
+		if !json.Valid(req.body) {
+			return nil, fmt.Errorf("rendered body is not valid json: %s", req.body)
+		}
+		if req.headers.Get("Content-Type") == "" {
+			req.headers.Set("Content-Type", "application/json")
+		}
+	}
+	if wh.Signature != nil {
+		req.headers.Set(wh.Signature.Header, wh.Signature.sign(req.body))
+	}
+
+	return req, nil
+}
+
+// webhookRequest is a rendered webhook request
+type webhookRequest struct {
+	url     string
+	headers http.Header
+	body    []byte
+}
+
+// sendWebhook sends the webhook request after its delay, retrying it on errors
+func (svc *service) sendWebhook(req *webhookRequest, wh *webhook) {
+	time.Sleep(time.Duration(wh.Delay) * time.Millisecond)
+
+	retryDelay := defaultWebhookRetryDelay
+	if wh.RetryDelay > 0 {
+		retryDelay = time.Duration(wh.RetryDelay) * time.Millisecond
+	}
+	for attempt := 0; ; attempt++ {
+		err := svc.doWebhook(req, wh.Method)
+		if err == nil {
+			svc.logger.Debug(fmt.Sprintf("webhook %s %s sent", wh.Method, req.url))
+			return
+		}
+		if attempt == wh.Retries {
+			svc.logger.Error(fmt.Sprintf("webhook %s %s failed after %d attempts", wh.Method, req.url, attempt+1), "error", err)
+			return
+		}
+		svc.logger.Warn(fmt.Sprintf("webhook %s %s failed, retrying in %s: %v", wh.Method, req.url, retryDelay, err))
+		time.Sleep(retryDelay)
+		retryDelay *= 2
+	}
+}
+
+// doWebhook sends the webhook request once, returning an error on errors, 429 or 5xx responses
+func (svc *service) doWebhook(req *webhookRequest, method string) error {
+	httpReq, err := http.NewRequest(method, req.url, bytes.NewReader(req.body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header = req.headers.Clone()
+
+	resp, err := webhookClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receivedWebhook is a webhook received by the test receiver
+type receivedWebhook struct {
+	method  string
+	path    string
+	headers http.Header
+	body    string
+}
+
+func Test_service_withWebhooks(t *testing.T) {
+	tests := []struct {
+		name       string
+		webhook    webhook
+		ratio      float64
+		failures   int32 // number of requests the receiver fails with a 503 status code
+		wantCalls  int32
+		wantPath   string
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name: "templated webhook with signature",
+			webhook: webhook{
+				URL:       "{{.Headers.Get \"X-Receiver\"}}/hooks/{{.Params.id}}",
+				Headers:   map[string]string{"X-Event": "charge.succeeded"},
+				Body:      json.RawMessage(`{"id": "{{.Params.id}}", "status": "succeeded"}`),
+				Signature: &webhookSignature{Secret: "s3cr3t"},
+			},
+			wantCalls:  1,
+			wantPath:   "/hooks/ch_1",
+			wantBody:   `{"id": "ch_1", "status": "succeeded"}`,
+			wantHeader: map[string]string{"X-Event": "charge.succeeded", "Content-Type": "application/json"},
+		},
+		{
+			name: "webhook retried on errors",
+			webhook: webhook{
+				URL:        "{{.Headers.Get \"X-Receiver\"}}/hooks",
+				Retries:    2,
+				RetryDelay: 10,
+			},
+			failures:  2,
+			wantCalls: 3,
+			wantPath:  "/hooks",
+		},
+		{
+			name: "webhook not triggered on failures",
+			webhook: webhook{
+				URL: "{{.Headers.Get \"X-Receiver\"}}/hooks",
+			},
+			ratio:     0.5,
+			wantCalls: 0,
+		},
+		{
+			name: "webhook triggered on failures",
+			webhook: webhook{
+				URL: "{{.Headers.Get \"X-Receiver\"}}/hooks/failed",
+				On:  "failure",
+			},
+			ratio:     0.5,
+			wantCalls: 1,
+			wantPath:  "/hooks/failed",
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			var calls atomic.Int32
+			received := make(chan receivedWebhook, 10)
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= test.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				received <- receivedWebhook{method: r.Method, path: r.URL.Path, headers: r.Header, body: string(body)}
+			}))
+			tt.Cleanup(receiver.Close)
+
+			rt := route{Path: "/charges/{id}", Methods: []string{http.MethodPost}, Webhooks: []webhook{test.webhook}}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			ratio := 1.0
+			if test.ratio != 0 {
+				ratio = test.ratio
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:       "/v1/mock",
+					successCode:     http.StatusOK,
+					successRespBody: json.RawMessage(`{"success":true}`),
+					failureCode:     http.StatusBadRequest,
+					successRatio:    ratio,
+					rateLimit:       1000,
+					routes:          []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/mock/charges/ch_1", nil)
+			req.Header.Set("X-Receiver", receiver.URL)
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, req)
+
+			if test.wantCalls == 0 {
+				time.Sleep(100 * time.Millisecond)
+				if got := calls.Load(); got != 0 {
+					tt.Errorf("expected no webhook calls, got %d", got)
+				}
+				return
+			}
+
+			var got receivedWebhook
+			select {
+			case got = <-received:
+			case <-time.After(5 * time.Second):
+				tt.Fatal("webhook not received")
+			}
+			if calls.Load() != test.wantCalls {
+				tt.Errorf("expected %d webhook calls, got %d", test.wantCalls, calls.Load())
+			}
+			if got.method != http.MethodPost || got.path != test.wantPath {
+				tt.Errorf("expected POST %s, got %s %s", test.wantPath, got.method, got.path)
+			}
+			if got.body != test.wantBody {
+				tt.Errorf("expected body %s, got %s", test.wantBody, got.body)
+			}
+			for key, value := range test.wantHeader {
+				if got.headers.Get(key) != value {
+					tt.Errorf("expected header %s %q, got %q", key, value, got.headers.Get(key))
+				}
+			}
+			if test.webhook.Signature != nil {
+				mac := hmac.New(sha256.New, []byte(test.webhook.Signature.Secret))
+				mac.Write([]byte(got.body))
+				if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.headers.Get("X-Signature") != want {
+					tt.Errorf("expected signature %s, got %s", want, got.headers.Get("X-Signature"))
+				}
+			}
+		})
+	}
+}
+
+func Test_webhook_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook webhook
+		wantErr bool
+	}{
+		{
+			name:    "valid webhook",
+			webhook: webhook{URL: "http://localhost:9000/hooks", Body: json.RawMessage(`{"id": "{{uuid}}"}`), Signature: &webhookSignature{Secret: "s3cr3t", Algorithm: "sha512", Encoding: "base64"}},
+		},
+		{
+			name:    "invalid url",
+			webhook: webhook{URL: "localhost:9000/hooks"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid trigger",
+			webhook: webhook{URL: "http://localhost:9000/hooks", On: "never"},
+			wantErr: true,
+		},
+		{
+			name:    "too many retries",
+			webhook: webhook{URL: "http://localhost:9000/hooks", Retries: 100},
+			wantErr: true,
+		},
+		{
+			name:    "invalid body",
+			webhook: webhook{URL: "http://localhost:9000/hooks", Body: json.RawMessage(`{"id": }`)},
+			wantErr: true,
+		},
+		{
+			name:    "signature without secret",
+			webhook: webhook{URL: "http://localhost:9000/hooks", Signature: &webhookSignature{}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported signature algorithm",
+			webhook: webhook{URL: "http://localhost:9000/hooks", Signature: &webhookSignature{Secret: "s3cr3t", Algorithm: "md5"}},
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			if err := test.webhook.validate(); (err != nil) != test.wantErr {
+				tt.Errorf("validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webSocket is the definition of a WebSocket route
+type webSocket struct {
+	OnConnect  []wsMessage   `json:"onConnect"`  // messages sent when a client connects
+	Replies    []wsReply     `json:"replies"`    // replies to incoming messages (the first matching one is used)
+	Periodic   *wsPeriodic   `json:"periodic"`   // message sent periodically
+	Disconnect *wsDisconnect `json:"disconnect"` // disconnect injection
+}
+
+// wsMessage is a message sent to WebSocket clients
+type wsMessage struct {
+	Data    json.RawMessage `json:"data"`   // any JSON value, strings are sent as is
+	Base64  bool            `json:"base64"` // whether the data string is base64 encoded (sent as a binary message)
+	Delay   int             `json:"delay"`  // delay before sending the message (in milliseconds)
+	payload []byte          // raw payload sent to clients
+}
+
+// wsReply are the messages sent when an incoming message matches
+type wsReply struct {
+	Match    wsMatch     `json:"match"`    // matching rule (any message if empty)
+	Messages []wsMessage `json:"messages"` // messages sent in reply
+}
+
+// wsMatch is a matching rule for incoming messages
+type wsMatch struct {
+	Equals   *string        `json:"equals"`   // message must be equal to the value
+	Contains string         `json:"contains"` // message must contain the value
+	Regex    string         `json:"regex"`    // message must match the regular expression
+	regex    *regexp.Regexp // compiled regular expression
+}
+
+// wsPeriodic is a message sent periodically
+type wsPeriodic struct {
+	Interval int       `json:"interval"` // interval between messages (in milliseconds)
+	Count    int       `json:"count"`    // number of messages to send (unlimited if 0)
+	Message  wsMessage `json:"message"`  // message to send
+}
+
+// wsDisconnect injects disconnects, closing the connection after a time or a number of incoming messages
+type wsDisconnect struct {
+	After         int    `json:"after"`         // time after the connection is closed (in milliseconds)
+	AfterMessages int    `json:"afterMessages"` // number of incoming messages after the connection is closed
+	Code          int    `json:"code"`          // close code sent to clients
+	Reason        string `json:"reason"`        // close reason sent to clients
+	Abrupt        bool   `json:"abrupt"`        // whether to drop the connection without a close message
+}
+
+// validate checks the WebSocket route definition, preparing its messages and matching rules
+func (ws *webSocket) validate() error {
+	for i := range ws.OnConnect {
+		if err := ws.OnConnect[i].validate(); err != nil {
+			return fmt.Errorf("onConnect message %d: %w", i, err)
+		}
+	}
+
+	for i := range ws.Replies {
+		reply := &ws.Replies[i]
+		if reply.Match.Regex != "" {
+			var err error
+			if reply.Match.regex, err = regexp.Compile(reply.Match.Regex); err != nil {
+				return fmt.Errorf("reply %d: invalid regex: %w", i, err)
+			}
+		}
+		for j := range reply.Messages {
+			if err := reply.Messages[j].validate(); err != nil {
+				return fmt.Errorf("reply %d: message %d: %w", i, j, err)
+			}
+		}
+	}
+
+	if ws.Periodic != nil {
+		if ws.Periodic.Interval <= 0 {
+			return errors.New("periodic message interval must be greater than 0")
+		}
+		if err := ws.Periodic.Message.validate(); err != nil {
+			return fmt.Errorf("periodic message: %w", err)
+		}
+	}
+
+	if ws.Disconnect != nil {
+		if ws.Disconnect.After <= 0 && ws.Disconnect.AfterMessages <= 0 {
+			return errors.New("disconnect requires either after or afterMessages")
+		}
+		if ws.Disconnect.Code == 0 {
+			ws.Disconnect.Code = websocket.CloseNormalClosure
+		}
+		if !validCloseCode(ws.Disconnect.Code) {
+			return fmt.Errorf("invalid close code %d", ws.Disconnect.Code)
+		}
+	}
+
+	return nil
+}
+
+// validCloseCode returns true if the close code can be sent in close frames (RFC 6455 section 7.4),
+// which excludes the reserved codes (1004, 1005, 1006 and 1015) and the unassigned ones (1016-2999)
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < websocket.CloseNormalClosure || code >= websocket.CloseTLSHandshake:
+		return false
+	default:
+		return code != 1004 && code != websocket.CloseNoStatusReceived && code != websocket.CloseAbnormalClosure
+	}
+}
+
+// validate checks the message data, preparing the payload sent to clients
+func (m *wsMessage) validate() error {
+	if m.Delay < 0 {
+		return errors.New("delay can't be negative")
+	}
+
+	var text string
+	switch {
+	case len(m.Data) == 0:
+		return errors.New("data is required")
+	case json.Unmarshal(m.Data, &text) == nil:
+		m.payload = []byte(text)
+	case m.Base64:
+		return errors.New("base64 data must be a string")
+	default:
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, m.Data); err != nil {
+			return err
+		}
+		m.payload = buf.Bytes()
+	}
+
+	if m.Base64 {
+		var err error
+		if m.payload, err = base64.StdEncoding.DecodeString(text); err != nil {
+			return fmt.Errorf("invalid base64 data: %w", err)
+		}
+		return nil
+	}
+	if isTemplate(m.payload) {
+		if _, err := parseTemplate(string(m.payload), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matches returns true if the incoming message matches the rule
+func (m *wsMatch) matches(msg string) bool {
+	if m.Equals != nil && msg != *m.Equals {
+		return false
+	}
+	if m.Contains != "" && !strings.Contains(msg, m.Contains) {
+		return false
+	}
+	if m.regex != nil && !m.regex.MatchString(msg) {
+		return false
+	}
+
+	return true
+}
+
+// upgrader upgrades the requests to WebSocket routes, accepting any origin as CORS does
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// wsSession is a WebSocket connection served by a WebSocket route
+type wsSession struct {
+	svc  *service
+	ws   *webSocket
+	conn *websocket.Conn
+	data templateData // template data of the upgrade request
+}
+
+// serveWebSocket returns a handler upgrading the connection and serving the WebSocket route
+func (svc *service) serveWebSocket(ws *webSocket) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader already replied with an error
+			svc.LogRequestFailure(r, "[serveWebSocket] upgrade failed", err)
+			return
+		}
+		defer conn.Close()
+
+		s := &wsSession{svc: svc, ws: ws, conn: conn, data: svc.newTemplateData(r)}
+		if err = s.serve(); err != nil {
+			svc.LogRequestFailure(r, "[serveWebSocket] connection closed", err)
+		}
+	}
+}
+
+// serve sends the scripted messages and replies to incoming ones until the connection is closed
+func (s *wsSession) serve() error {
+	done := make(chan struct{})
+	defer close(done)
+
+	// Read incoming messages
+	incoming, readErr := make(chan string), make(chan error, 1)
+	go func() {
+		for {
+			_, msg, err := s.conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- string(msg):
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := s.send(s.ws.OnConnect, s.data); err != nil {
+		return err
+	}
+
+	var tick <-chan time.Time
+	sent := 0
+	if s.ws.Periodic != nil {
+		ticker := time.NewTicker(time.Duration(s.ws.Periodic.Interval) * time.Millisecond)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var disconnect <-chan time.Time
+	received := 0
+	if s.ws.Disconnect != nil && s.ws.Disconnect.After > 0 {
+		timer := time.NewTimer(time.Duration(s.ws.Disconnect.After) * time.Millisecond)
+		defer timer.Stop()
+		disconnect = timer.C
+	}
+
+	for {
+		select {
+		case msg := <-incoming:
+			data := s.data
+			data.Message = msg
+			for _, reply := range s.ws.Replies {
+				if reply.Match.matches(msg) {
+					if err := s.send(reply.Messages, data); err != nil {
+						return err
+					}
+					break
+				}
+			}
+			received++
+			if s.ws.Disconnect != nil && received == s.ws.Disconnect.AfterMessages {
+				return s.disconnect()
+			}
+		case <-tick:
+			if err := s.send([]wsMessage{s.ws.Periodic.Message}, s.data); err != nil {
+				return err
+			}
+			if sent++; sent == s.ws.Periodic.Count {
+				tick = nil
+			}
+		case <-disconnect:
+			return s.disconnect()
+		case err := <-readErr:
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// send sends the messages to the client, rendering their templates (if any) with the given data
+func (s *wsSession) send(messages []wsMessage, data templateData) error {
+	for _, m := range messages {
+		if m.Delay > 0 {
+			time.Sleep(time.Duration(m.Delay) * time.Millisecond)
+		}
+
+		msgType, payload := websocket.BinaryMessage, m.payload
+		if !m.Base64 {
+			msgType = websocket.TextMessage
+			var err error
+			if payload, err = s.svc.renderTemplate(payload, data); err != nil {
+				return fmt.Errorf("message template: %w", err)
+			}
+		}
+
+		if err := s.conn.WriteMessage(msgType, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// disconnect closes the connection as configured, either with a close message or abruptly
+func (s *wsSession) disconnect() error {
+	if s.ws.Disconnect.Abrupt {
+		return s.conn.NetConn().Close()
+	}
+
+	msg := websocket.FormatCloseMessage(s.ws.Disconnect.Code, s.ws.Disconnect.Reason)
+
+	return s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func Test_service_serveWebSocket(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		send       []string
+		want       []string
+		wantClose  int
+	}{
+		{
+			name:       "messages on connect",
+			definition: `{"onConnect": [{"data": {"type": "hello", "path": "{{.Path}}"}}, {"data": "welcome", "delay": 10}]}`,
+			want:       []string{`{"type":"hello","path":"/v1/mock/ws"}`, "welcome"},
+		},
+		{
+			name: "replies to incoming messages",
+			definition: `{"replies": [
+				{"match": {"equals": "ping"}, "messages": [{"data": "pong"}]},
+				{"match": {"regex": "^subscribe:"}, "messages": [{"data": {"subscribed": "{{.Message}}"}}]},
+				{"messages": [{"data": "unknown command"}]}
+			]}`,
+			send: []string{"ping", "subscribe:prices", "foo"},
+			want: []string{"pong", `{"subscribed":"subscribe:prices"}`, "unknown command"},
+		},
+		{
+			name:       "periodic messages",
+			definition: `{"periodic": {"interval": 10, "count": 3, "message": {"data": {"price": 100}}}}`,
+			want:       []string{`{"price":100}`, `{"price":100}`, `{"price":100}`},
+		},
+		{
+			name:       "disconnect after incoming messages",
+			definition: `{"replies": [{"messages": [{"data": "ack"}]}], "disconnect": {"afterMessages": 2, "code": 1011, "reason": "boom"}}`,
+			send:       []string{"foo", "bar"},
+			want:       []string{"ack", "ack"},
+			wantClose:  websocket.CloseInternalServerErr,
+		},
+		{
+			name:       "disconnect after a time",
+			definition: `{"disconnect": {"after": 10}}`,
+			wantClose:  websocket.CloseNormalClosure,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			rt := route{Path: "/ws"}
+			if err := json.Unmarshal([]byte(test.definition), &rt.WebSocket); err != nil {
+				tt.Fatal(err)
+			}
+			if err := rt.validate(); err != nil {
+				tt.Fatalf("invalid route: %v", err)
+			}
+			svc := &service{
+				cfg: &config{
+					uriPrefix:    "/v1/mock",
+					successRatio: 1.0,
+					rateLimit:    1000,
+					routes:       []route{rt},
+				},
+				reqCounter: 1,
+				logger:     newStructuredLogger(slog.LevelDebug),
+			}
+			svc.makeRouter()
+			server := httptest.NewServer(svc.router)
+			defer server.Close()
+
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/mock/ws", nil)
+			if err != nil {
+				tt.Fatalf("could not connect: %v", err)
+			}
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+			for _, msg := range test.send {
+				if err = conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+					tt.Fatal(err)
+				}
+			}
+			for _, want := range test.want {
+				_, got, err := conn.ReadMessage()
+				if err != nil {
+					tt.Fatalf("could not read message: %v", err)
+				}
+				if string(got) != want {
+					tt.Errorf("expected message %s, got %s", want, got)
+				}
+			}
+			if test.wantClose != 0 {
+				_, _, err = conn.ReadMessage()
+				if !websocket.IsCloseError(err, test.wantClose) {
+					tt.Errorf("expected close error %d, got %v", test.wantClose, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_serveWebSocket_failure(t *testing.T) {
+	rt := route{Path: "/ws", WebSocket: &webSocket{}}
+	if err := rt.validate(); err != nil {
+		t.Fatal(err)
+	}
+	svc := &service{
+		cfg: &config{
+			uriPrefix:    "/v1/mock",
+			failureCode:  http.StatusServiceUnavailable,
+			successRatio: 0.5,
+			rateLimit:    1000,
+			routes:       []route{rt},
+		},
+		logger: newStructuredLogger(slog.LevelDebug),
+	}
+	svc.makeRouter()
+	server := httptest.NewServer(svc.router)
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/mock/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	conn.Close()
+
+	// Every second request fails with a 0.5 success ratio
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("expected handshake failure")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
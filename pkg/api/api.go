@@ -1,12 +1,31 @@
 package api
 
+import "encoding/json"
+
 // SingleRequest is the request body for a single request
+//
+// Deprecated: use BatchRequest, which describes the fields of the requests of batch requests.
 type SingleRequest map[string]interface{}
 
-// BatchResponse is the response body for a batch request
+// BatchRequest is a request of a batch request
+type BatchRequest struct {
+	Method      string          `json:"method"`       // Request method (defaults to GET)
+	RelativeURL string          `json:"relative_url"` // Request URL relative to the URI prefix, with its query string
+	Headers     []Header        `json:"headers"`      // Request headers
+	Body        json.RawMessage `json:"body"`         // Request body: strings are sent as is, other JSON values JSON encoded
+}
+
+// BatchResponse is the response to a request of a batch request
 type BatchResponse struct {
-	Code int    `json:"code"`
-	Body string `json:"body"`
+	Code    int      `json:"code"`    // Response status code
+	Headers []Header `json:"headers"` // Response headers
+	Body    string   `json:"body"`    // Response body
+}
+
+// Header is a header of the requests and responses of a batch request
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // HTTPErrorResponse represents the typical API error response body
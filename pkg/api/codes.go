@@ -8,4 +8,10 @@ const (
 	CodeMethodNotAllowed  = requestBase + 3
 	CodeRateLimitExceeded = requestBase + 4
 	CodeFailedRequest     = requestBase + 5
+	CodeNotAcceptable     = requestBase + 6
+	CodeTemplateError     = requestBase + 7
+	CodeSchemaError       = requestBase + 8
+	CodeBatchTooLarge     = requestBase + 9
+	CodeForbidden         = requestBase + 10
+	CodeBodyTooLarge      = requestBase + 11
 )
@@ -1,38 +1,111 @@
 package authn
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 )
 
-const authenticateHeader string = `Bearer realm="example", error="invalid_token", error_description="invalid access token"`
+const (
+	authenticateHeader      string = `Bearer realm="example", error="invalid_token", error_description="invalid access token"`
+	basicAuthenticateHeader string = `Basic realm="example", charset="UTF-8"`
+)
 
-// ApiKeyAuth implements a simple middleware handler for adding
-// authentication based on an API key set in the X-API-KEY header.
-func ApiKeyAuth(key string) func(next http.Handler) http.Handler {
+// Scheme is an authentication scheme checking the credentials of requests.
+type Scheme struct {
+	authenticate func(r *http.Request) (*http.Request, bool) // checks the credentials, returning the request with its authentication details
+	challenge    string                                      // WWW-Authenticate header of unauthenticated requests (if any)
+}
+
+// ApiKey returns a scheme accepting any of the given API keys set in the X-API-KEY header.
+func ApiKey(keys ...string) Scheme {
+	return Scheme{
+		authenticate: func(r *http.Request) (*http.Request, bool) {
+			return r, matchesAny(r.Header.Get("X-API-KEY"), keys)
+		},
+	}
+}
+
+// BearerToken returns a scheme accepting any of the given bearer tokens set in the Authorization header,
+// with or without the "Bearer " prefix.
+func BearerToken(tokens ...string) Scheme {
+	return Scheme{
+		authenticate: func(r *http.Request) (*http.Request, bool) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			return r, matchesAny(token, tokens)
+		},
+		challenge: authenticateHeader,
+	}
+}
+
+// Basic returns a scheme accepting the HTTP Basic credentials of any of the given users,
+// indexed by user name.
+func Basic(users map[string]string) Scheme {
+	return Scheme{
+		authenticate: func(r *http.Request) (*http.Request, bool) {
+			user, password, ok := r.BasicAuth()
+			if !ok {
+				return r, false
+			}
+			want, found := users[user]
+			return r, found && subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+		},
+		challenge: basicAuthenticateHeader,
+	}
+}
+
+// AnyOf implements a middleware handler for adding authentication to a route,
+// accepting the requests authenticated by any of the given schemes.
+func AnyOf(schemes ...Scheme) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Header.Get("X-API-KEY") != key {
-				w.WriteHeader(http.StatusUnauthorized)
-				return
+			for _, scheme := range schemes {
+				if authenticated, ok := scheme.authenticate(r); ok {
+					next.ServeHTTP(w, authenticated)
+					return
+				}
 			}
-			next.ServeHTTP(w, r)
+
+			for _, scheme := range schemes {
+				if scheme.challenge != "" {
+					w.Header().Add("WWW-Authenticate", scheme.challenge)
+				}
+			}
+			w.WriteHeader(http.StatusUnauthorized)
 		})
 	}
 }
 
+// ApiKeyAuth implements a simple middleware handler for adding
+// authentication based on API keys set in the X-API-KEY header.
+func ApiKeyAuth(keys ...string) func(next http.Handler) http.Handler {
+	return AnyOf(ApiKey(keys...))
+}
+
 // BearerTokenAuth implements a simple middleware handler for adding
 // bearer http auth based on tokens to a route.
-func BearerTokenAuth(token string) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if strings.TrimPrefix(authHeader, "Bearer ") != token {
-				w.Header().Add("WWW-Authenticate", authenticateHeader)
-				w.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+func BearerTokenAuth(tokens ...string) func(next http.Handler) http.Handler {
+	return AnyOf(BearerToken(tokens...))
+}
+
+// BasicAuth implements a simple middleware handler for adding
+// HTTP Basic auth based on user credentials to a route.
+func BasicAuth(users map[string]string) func(next http.Handler) http.Handler {
+	return AnyOf(Basic(users))
+}
+
+// matchesAny returns true if the credential is not empty and matches any of the given ones
+func matchesAny(credential string, valid []string) bool {
+	if credential == "" {
+		return false
+	}
+	matched := false
+	for _, v := range valid {
+		// compare every credential in constant time
+		if subtle.ConstantTimeCompare([]byte(credential), []byte(v)) == 1 {
+			matched = true
+		}
 	}
+
+	return matched
 }
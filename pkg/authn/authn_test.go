@@ -71,6 +71,11 @@ func TestBearerTokenAuth(t *testing.T) {
 			fmt.Sprintf("Bearer %s", defaultToken),
 			http.StatusOK,
 		},
+		{
+			"valid auth without the Bearer prefix",
+			defaultToken,
+			http.StatusOK,
+		},
 		{
 			"missing token",
 			"",
@@ -107,3 +112,143 @@ func TestBearerTokenAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestBasicAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		setAuth  bool
+		want     int
+	}{
+		{
+			"valid auth",
+			"alice",
+			"secret",
+			true,
+			http.StatusOK,
+		},
+		{
+			"missing credentials",
+			"",
+			"",
+			false,
+			http.StatusUnauthorized,
+		},
+		{
+			"invalid password",
+			"alice",
+			"foo",
+			true,
+			http.StatusUnauthorized,
+		},
+		{
+			"unknown user",
+			"mallory",
+			"secret",
+			true,
+			http.StatusUnauthorized,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+
+			r := chi.NewRouter()
+			r.Use(BasicAuth(map[string]string{"alice": "secret", "bob": "other-secret"}))
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.setAuth {
+				req.SetBasicAuth(test.user, test.password)
+			}
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != test.want {
+				tt.Errorf("response status code is incorrect, got %d, want %d", res.StatusCode, test.want)
+			}
+			if test.want == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") != basicAuthenticateHeader {
+				tt.Errorf("WWW-Authenticate header is incorrect, got %q", res.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{
+			"valid API key",
+			map[string]string{"X-API-KEY": "other-key"},
+			http.StatusOK,
+		},
+		{
+			"valid token",
+			map[string]string{"Authorization": fmt.Sprintf("Bearer %s", defaultToken)},
+			http.StatusOK,
+		},
+		{
+			"valid basic auth",
+			map[string]string{"Authorization": "Basic YWxpY2U6c2VjcmV0"},
+			http.StatusOK,
+		},
+		{
+			"invalid token with a valid API key",
+			map[string]string{"Authorization": "Bearer foo", "X-API-KEY": defaultKey},
+			http.StatusOK,
+		},
+		{
+			"missing credentials",
+			map[string]string{},
+			http.StatusUnauthorized,
+		},
+		{
+			"invalid credentials",
+			map[string]string{"Authorization": "Bearer foo", "X-API-KEY": "foo"},
+			http.StatusUnauthorized,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+
+			r := chi.NewRouter()
+			r.Use(AnyOf(
+				ApiKey(defaultKey, "other-key"),
+				BearerToken(defaultToken),
+				Basic(map[string]string{"alice": "secret"}),
+			))
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != test.want {
+				tt.Errorf("response status code is incorrect, got %d, want %d", res.StatusCode, test.want)
+			}
+			if test.want == http.StatusUnauthorized && len(res.Header.Values("WWW-Authenticate")) != 2 {
+				tt.Errorf("expected the bearer and basic challenges, got %v", res.Header.Values("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package authn
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWT signing algorithms supported
+const (
+	algHS256 string = "HS256"
+	algRS256 string = "RS256"
+	algES256 string = "ES256"
+)
+
+// claimsKey is the context key holding the claims of the JWT authenticating a request
+type claimsKey struct{}
+
+// JWTConfig is the configuration of the validation of JWT bearer tokens.
+type JWTConfig struct {
+	Secret   []byte // shared secret verifying HS256 signatures
+	Keys     []JWK  // public keys verifying RS256 and ES256 signatures
+	Issuer   string // expected issuer (not checked if empty)
+	Audience string // expected audience (not checked if empty)
+}
+
+// JWK is a public key of a JSON Web Key Set (RFC 7517).
+type JWK struct {
+	ID  string           // key ID, matched against the "kid" header of tokens (if any)
+	Key crypto.PublicKey // *rsa.PublicKey or *ecdsa.PublicKey (P-256)
+}
+
+// jsonWebKey is the JSON representation of a JWK
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS loads the RSA and EC (P-256) signature keys of a JSON Web Key Set file.
+func LoadJWKS(path string) ([]JWK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses the RSA and EC (P-256) signature keys of a JSON Web Key Set,
+// ignoring encryption keys and keys of other types.
+func ParseJWKS(data []byte) ([]JWK, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	var keys []JWK
+	for i, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaPublicKey()
+		case "EC":
+			key, err = k.ecdsaPublicKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d of JWKS: %w", i, err)
+		}
+		keys = append(keys, JWK{ID: k.Kid, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no RSA or EC signature keys")
+	}
+
+	return keys, nil
+}
+
+// rsaPublicKey returns the RSA public key of the JWK
+func (k *jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+// ecdsaPublicKey returns the ECDSA (P-256) public key of the JWK
+func (k *jsonWebKey) ecdsaPublicKey() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != 32 {
+		return nil, errors.New("invalid x coordinate")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil || len(y) != 32 {
+		return nil, errors.New("invalid y coordinate")
+	}
+
+	// the uncompressed point encoding is parsed to check the point is on the curve
+	key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+
+	return key, nil
+}
+
+// JWT returns a scheme accepting the JWT bearer tokens set in the Authorization header that are
+// signed with the configured secret or keys, not expired and, if configured, issued by the expected
+// issuer for the expected audience. The token claims are available with Claims.
+func JWT(cfg JWTConfig) Scheme {
+	return Scheme{
+		authenticate: func(r *http.Request) (*http.Request, bool) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				return r, false
+			}
+			claims, err := ValidateJWT(token, cfg, time.Now())
+			if err != nil {
+				return r, false
+			}
+
+			return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)), true
+		},
+		challenge: authenticateHeader,
+	}
+}
+
+// Claims returns the claims of the JWT authenticating the request (nil if it wasn't authenticated by a JWT).
+func Claims(r *http.Request) map[string]interface{} {
+	claims, _ := r.Context().Value(claimsKey{}).(map[string]interface{})
+	return claims
+}
+
+// ValidateJWT validates a JWT at the given time, returning its claims. Numeric claims are returned as json.Number.
+func ValidateJWT(token string, cfg JWTConfig, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if err = verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature, cfg); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	if err = validateClaims(claims, cfg, now); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(v)
+}
+
+// verifySignature verifies the signature of the signed content of a JWT with the secret or the keys
+// of the configuration suitable for its algorithm, only using the key with the given ID if any
+func verifySignature(alg, kid, signed string, signature []byte, cfg JWTConfig) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case algHS256:
+		if len(cfg.Secret) == 0 {
+			return fmt.Errorf("unsupported algorithm %s", alg)
+		}
+		mac := hmac.New(sha256.New, cfg.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case algRS256, algES256:
+		for _, k := range cfg.Keys {
+			if kid != "" && k.ID != kid {
+				continue
+			}
+			switch key := k.Key.(type) {
+			case *rsa.PublicKey:
+				if alg == algRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+					return nil
+				}
+			case *ecdsa.PublicKey:
+				if alg == algES256 && len(signature) == 64 &&
+					ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+					return nil
+				}
+			}
+		}
+		return errors.New("invalid signature")
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// validateClaims checks the token is valid at the given time and, if configured,
+// it's issued by the expected issuer for the expected audience
+func validateClaims(claims map[string]interface{}, cfg JWTConfig, now time.Time) error {
+	if exp, ok, err := numericDate(claims, "exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok, err := numericDate(claims, "nbf"); err != nil {
+		return err
+	} else if ok && now.Before(nbf) {
+		return errors.New("token is not valid yet")
+	}
+
+	if cfg.Issuer != "" && claims["iss"] != cfg.Issuer {
+		return fmt.Errorf("invalid issuer %v", claims["iss"])
+	}
+	if cfg.Audience != "" {
+		audiences := []interface{}{claims["aud"]}
+		if aud, ok := claims["aud"].([]interface{}); ok {
+			audiences = aud
+		}
+		found := false
+		for _, aud := range audiences {
+			if aud == cfg.Audience {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid audience %v", claims["aud"])
+		}
+	}
+
+	return nil
+}
+
+// maxNumericDate is the furthest NumericDate (in seconds) converted to a time, within the int64 range
+const maxNumericDate = 1 << 62
+
+// numericDate returns the time of a NumericDate claim (seconds since the epoch), if set
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	value, found := claims[name]
+	if !found {
+		return time.Time{}, false, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("invalid %s claim", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s claim: %w", name, err)
+	}
+
+	// seconds and fractions are converted separately so far dates don't overflow the nanoseconds,
+	// and seconds are clamped so dates beyond the int64 range stay in the far future (or past)
+	secs, frac := math.Modf(seconds)
+	secs = math.Max(-maxNumericDate, math.Min(secs, maxNumericDate))
+
+	return time.Unix(int64(secs), int64(frac*1e9)), true, nil
+}
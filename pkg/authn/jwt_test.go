@@ -0,0 +1,269 @@
+package authn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultSecret string = "some-secret"
+
+// signJWT returns a JWT holding the given claims signed with the given algorithm and key
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("could not sign token: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("could not sign token: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// makeJWKS returns the JWKS holding the public keys of the given RSA and ECDSA keys
+func makeJWKS(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kid": "enc-key", "kty": "RSA", "use": "enc", "n": "invalid", "e": "invalid"},
+		{"kid": "oct-key", "kty": "oct", "k": "c2VjcmV0"},
+		{"kid": "rsa-key", "kty": "RSA", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kid": "ec-key", "kty": "EC", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+
+	return jwks
+}
+
+func TestValidateJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ECDSA key: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ECDSA key: %v", err)
+	}
+	keys, err := ParseJWKS(makeJWKS(rsaKey, ecKey))
+	if err != nil {
+		t.Fatalf("could not parse JWKS: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 signature keys, got %d", len(keys))
+	}
+
+	now := time.Now()
+	cfg := JWTConfig{Secret: []byte(defaultSecret), Keys: keys, Issuer: "https://issuer.example.com", Audience: "api-mock"}
+	validClaims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "alice",
+			"iss": cfg.Issuer,
+			"aud": cfg.Audience,
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for name, value := range overrides {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "valid HS256 token",
+			token: signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(nil)),
+		},
+		{
+			name:  "valid RS256 token",
+			token: signJWT(t, algRS256, "rsa-key", rsaKey, validClaims(nil)),
+		},
+		{
+			name:  "valid ES256 token without key ID",
+			token: signJWT(t, algES256, "", ecKey, validClaims(nil)),
+		},
+		{
+			name:  "valid token with several audiences",
+			token: signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"aud": []string{"other", "api-mock"}})),
+		},
+		{
+			name:  "valid token without expiry",
+			token: signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"exp": nil})),
+		},
+		{
+			name:  "valid token expiring after 2262",
+			token: signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"exp": 9999999999})),
+		},
+		{
+			name:  "valid token expiring beyond the int64 range",
+			token: signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"exp": 1e19})),
+		},
+		{
+			name:    "token not valid until beyond the int64 range",
+			token:   signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"nbf": 1e19})),
+			wantErr: true,
+		},
+		{
+			name:  "valid token with fractional expiry",
+			token: signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"exp": float64(now.Unix()) + 1.5})),
+		},
+		{
+			name:    "expired token",
+			token:   signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "token not valid yet",
+			token:   signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "invalid expiry",
+			token:   signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"exp": "tomorrow"})),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"iss": "https://evil.example.com"})),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   signJWT(t, algHS256, "", []byte(defaultSecret), validClaims(map[string]interface{}{"aud": []string{"other"}})),
+			wantErr: true,
+		},
+		{
+			name:    "wrong secret",
+			token:   signJWT(t, algHS256, "", []byte("other-secret"), validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "unknown signing key",
+			token:   signJWT(t, algES256, "", otherKey, validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "key ID of another key",
+			token:   signJWT(t, algES256, "rsa-key", ecKey, validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned token",
+			token:   signJWT(t, "none", "", nil, validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "malformed token",
+			token:   "not-a-jwt",
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			claims, err := ValidateJWT(test.token, cfg, now)
+			if (err != nil) != test.wantErr {
+				tt.Fatalf("ValidateJWT() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && claims["sub"] != "alice" {
+				tt.Errorf("unexpected claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestJWT(t *testing.T) {
+	tests := []struct {
+		name       string
+		authHeader string
+		want       int
+	}{
+		{
+			"valid auth",
+			fmt.Sprintf("Bearer %s", signJWT(t, algHS256, "", []byte(defaultSecret), map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})),
+			http.StatusOK,
+		},
+		{
+			"missing token",
+			"",
+			http.StatusUnauthorized,
+		},
+		{
+			"expired token",
+			fmt.Sprintf("Bearer %s", signJWT(t, algHS256, "", []byte(defaultSecret), map[string]interface{}{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})),
+			http.StatusUnauthorized,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+
+			r := chi.NewRouter()
+			r.Use(AnyOf(JWT(JWTConfig{Secret: []byte(defaultSecret)})))
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(fmt.Sprint(Claims(r)["sub"])))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", test.authHeader)
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			res := recorder.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != test.want {
+				tt.Errorf("response status code is incorrect, got %d, want %d", res.StatusCode, test.want)
+			}
+			if test.want == http.StatusOK && recorder.Body.String() != "alice" {
+				tt.Errorf("expected the token claims, got subject %q", recorder.Body.String())
+			}
+		})
+	}
+}
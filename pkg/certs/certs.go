@@ -0,0 +1,187 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// CAFile is the name of the generated CA certificate file
+	CAFile = "ca.crt"
+	// CAKeyFile is the name of the generated CA private key file
+	CAKeyFile = "ca.key"
+	// CertFile is the name of the generated server certificate file
+	CertFile = "tls.crt"
+	// KeyFile is the name of the generated server private key file
+	KeyFile = "tls.key"
+
+	validity = 365 * 24 * time.Hour
+)
+
+// EnsureSelfSigned makes sure a self-signed CA and a server certificate signed by it
+// for the given hosts (DNS names or IP addresses) exist in the given directory, generating
+// them if needed. Existing certificates are reused so clients trusting the CA keep working
+// across restarts, unless they have expired or don't cover the given hosts.
+// It returns the paths to the server certificate and private key files.
+func EnsureSelfSigned(dir string, hosts []string) (string, string, error) {
+	if len(hosts) == 0 {
+		return "", "", errors.New("at least one host is required")
+	}
+
+	certFile, keyFile := filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile)
+	if valid(filepath.Join(dir, CAFile), certFile, keyFile, hosts) {
+		return certFile, keyFile, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+
+	ca, caKey, err := loadOrCreateCA(filepath.Join(dir, CAFile), filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		return "", "", fmt.Errorf("CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl, err := newTemplate(hosts[0])
+	if err != nil {
+		return "", "", err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+	if err = writeFiles(certFile, keyFile, der, key); err != nil {
+		return "", "", err
+	}
+
+	return certFile, keyFile, nil
+}
+
+// valid returns true if the certificate and key files exist, match each other,
+// are signed by the CA, are not about to expire and cover all the given hosts
+func valid(caFile, certFile, keyFile string, hosts []string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return false
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return false
+	}
+
+	for _, host := range hosts {
+		opts := x509.VerifyOptions{
+			DNSName:     host,
+			Roots:       roots,
+			CurrentTime: time.Now().Add(24 * time.Hour),
+		}
+		if _, err = cert.Verify(opts); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadOrCreateCA loads the CA certificate and key from the given files,
+// generating a new CA if they don't exist
+func loadOrCreateCA(caFile, caKeyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	if pair, err := tls.LoadX509KeyPair(caFile, caKeyFile); err == nil {
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if ok && ca.IsCA && time.Now().Before(ca.NotAfter) {
+			return ca, key, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl, err := newTemplate("api-mock CA")
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = writeFiles(caFile, caKeyFile, der, key); err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ca, key, nil
+}
+
+// newTemplate returns a certificate template with a random serial number
+func newTemplate(commonName string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"api-mock"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+	}, nil
+}
+
+// writeFiles writes a PEM encoded certificate and private key to the given files
+func writeFiles(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(
+		os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644),
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600),
+	)
+}
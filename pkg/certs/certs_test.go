@@ -0,0 +1,74 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureSelfSigned(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	hosts := []string{"localhost", "127.0.0.1"}
+
+	certFile, keyFile, err := EnsureSelfSigned(dir, hosts)
+	if err != nil {
+		t.Fatalf("EnsureSelfSigned() error = %v", err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("could not load generated key pair: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server certificate must be trusted by clients trusting the CA
+	caPEM, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	for _, host := range hosts {
+		if _, err = cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("certificate is not valid for %s: %v", host, err)
+		}
+	}
+
+	// Existing certificates are reused
+	if _, _, err = EnsureSelfSigned(dir, hosts); err != nil {
+		t.Fatal(err)
+	}
+	reused, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reused.Certificate[0]) != string(pair.Certificate[0]) {
+		t.Errorf("expected existing certificate to be reused")
+	}
+
+	// Certificates are regenerated, with the same CA, when hosts change
+	if _, _, err = EnsureSelfSigned(dir, []string{"api.test"}); err != nil {
+		t.Fatal(err)
+	}
+	regenerated, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(regenerated.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cert.Verify(x509.VerifyOptions{DNSName: "api.test", Roots: roots}); err != nil {
+		t.Errorf("regenerated certificate is not valid: %v", err)
+	}
+}
+
+func TestEnsureSelfSigned_noHosts(t *testing.T) {
+	if _, _, err := EnsureSelfSigned(t.TempDir(), nil); err == nil {
+		t.Errorf("EnsureSelfSigned() expected an error")
+	}
+}
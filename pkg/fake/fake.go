@@ -0,0 +1,219 @@
+package fake
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	firstNames = []string{
+		"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda", "David", "Elizabeth",
+		"William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Carlos", "Lucia",
+		"Juan", "Sofia", "Hiroshi", "Yuki", "Ahmed", "Fatima", "Ivan", "Olga", "Chen", "Mei",
+	}
+	lastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin",
+		"Lee", "Perez", "Thompson", "White", "Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson",
+	}
+	domains     = []string{"example.com", "example.org", "example.net", "mail.test", "corp.test"}
+	streetNames = []string{
+		"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake", "Hill", "Park",
+		"Sunset", "River", "Church", "Mill", "Spring", "Highland", "Forest", "Meadow", "Valley", "Ridge",
+	}
+	streetSuffixes = []string{"St", "Ave", "Rd", "Blvd", "Ln", "Dr", "Way", "Ct"}
+	cities         = []string{
+		"Springfield", "Riverside", "Franklin", "Greenville", "Bristol", "Clinton", "Fairview", "Salem",
+		"Madison", "Georgetown", "Arlington", "Ashland", "Dover", "Oxford", "Jackson", "Burlington",
+	}
+	countries = []string{
+		"United States", "Spain", "Germany", "France", "Japan", "Brazil", "Canada", "India", "Italy", "Mexico",
+		"United Kingdom", "Australia", "Netherlands", "Sweden", "Portugal", "Argentina",
+	}
+	companySuffixes = []string{"Inc", "LLC", "Group", "Corp", "Labs", "Systems", "Solutions"}
+	loremWords      = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor
+		incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris
+		nisi aliquip ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse cillum eu fugiat
+		nulla pariatur excepteur sint occaecat cupidatat non proident sunt culpa qui officia deserunt mollit anim id
+		est laborum`)
+)
+
+// Generator generates realistic fake data. It's safe for concurrent use.
+type Generator struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New creates a new fake data generator. Generators created with the
+// same seed produce the same sequence of values.
+func New(seed int64) *Generator {
+	return &Generator{rnd: rand.New(rand.NewSource(seed))} //nolint:gosec // fake data doesn't require a secure source
+}
+
+// Intn returns a random int in [0, n)
+func (g *Generator) Intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rnd.Intn(n)
+}
+
+// Float64 returns a random float64 in [0.0, 1.0)
+func (g *Generator) Float64() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rnd.Float64()
+}
+
+// Int returns a random int in [low, high]
+func (g *Generator) Int(low, high int) int {
+	if high < low {
+		low, high = high, low
+	}
+	return low + g.Intn(high-low+1)
+}
+
+// Float returns a random float64 in [low, high)
+func (g *Generator) Float(low, high float64) float64 {
+	if high < low {
+		low, high = high, low
+	}
+	return low + g.Float64()*(high-low)
+}
+
+// Bool returns a random boolean
+func (g *Generator) Bool() bool {
+	return g.Intn(2) == 1
+}
+
+// Pick returns a random element of the given values
+func (g *Generator) Pick(values ...string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[g.Intn(len(values))]
+}
+
+// FirstName returns a random first name
+func (g *Generator) FirstName() string {
+	return g.Pick(firstNames...)
+}
+
+// LastName returns a random last name
+func (g *Generator) LastName() string {
+	return g.Pick(lastNames...)
+}
+
+// Name returns a random full name
+func (g *Generator) Name() string {
+	return g.FirstName() + " " + g.LastName()
+}
+
+// Username returns a random username
+func (g *Generator) Username() string {
+	return fmt.Sprintf("%s.%s%d", strings.ToLower(g.FirstName()), strings.ToLower(g.LastName()), g.Intn(100))
+}
+
+// Email returns a random email address
+func (g *Generator) Email() string {
+	return g.Username() + "@" + g.Pick(domains...)
+}
+
+// Phone returns a random phone number
+func (g *Generator) Phone() string {
+	return fmt.Sprintf("+1-%03d-555-%04d", g.Int(200, 999), g.Intn(10000))
+}
+
+// Company returns a random company name
+func (g *Generator) Company() string {
+	return g.LastName() + " " + g.Pick(companySuffixes...)
+}
+
+// Street returns a random street address
+func (g *Generator) Street() string {
+	return fmt.Sprintf("%d %s %s", g.Int(1, 9999), g.Pick(streetNames...), g.Pick(streetSuffixes...))
+}
+
+// City returns a random city name
+func (g *Generator) City() string {
+	return g.Pick(cities...)
+}
+
+// Country returns a random country name
+func (g *Generator) Country() string {
+	return g.Pick(countries...)
+}
+
+// ZipCode returns a random zip code
+func (g *Generator) ZipCode() string {
+	return fmt.Sprintf("%05d", g.Intn(100000))
+}
+
+// Address returns a random full address
+func (g *Generator) Address() string {
+	return fmt.Sprintf("%s, %s %s, %s", g.Street(), g.City(), g.ZipCode(), g.Country())
+}
+
+// UUID returns a random (version 4) UUID
+func (g *Generator) UUID() string {
+	b := make([]byte, 16)
+	g.mu.Lock()
+	_, _ = g.rnd.Read(b)
+	g.mu.Unlock()
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Time returns a random time between from and to
+func (g *Generator) Time(from, to time.Time) time.Time {
+	if to.Before(from) {
+		from, to = to, from
+	}
+	delta := to.Sub(from)
+	if delta <= 0 {
+		return from
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return from.Add(time.Duration(g.rnd.Int63n(int64(delta)))).UTC().Truncate(time.Second)
+}
+
+// Word returns a random lorem ipsum word
+func (g *Generator) Word() string {
+	return g.Pick(loremWords...)
+}
+
+// Words returns n random lorem ipsum words separated by spaces
+func (g *Generator) Words(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	words := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		words = append(words, g.Word())
+	}
+	return strings.Join(words, " ")
+}
+
+// Sentence returns a random lorem ipsum sentence
+func (g *Generator) Sentence() string {
+	sentence := g.Words(g.Int(4, 12))
+	return strings.ToUpper(sentence[:1]) + sentence[1:] + "."
+}
+
+// Paragraph returns a random lorem ipsum paragraph
+func (g *Generator) Paragraph() string {
+	sentences := make([]string, 0, 5)
+	for i := g.Int(3, 5); i > 0; i-- {
+		sentences = append(sentences, g.Sentence())
+	}
+	return strings.Join(sentences, " ")
+}
@@ -0,0 +1,45 @@
+package fake
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	g1, g2 := New(42), New(42)
+	for i := 0; i < 10; i++ {
+		if v1, v2 := g1.Name()+g1.Email()+g1.UUID(), g2.Name()+g2.Email()+g2.UUID(); v1 != v2 {
+			t.Errorf("generators with the same seed must produce the same values, got %s and %s", v1, v2)
+		}
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	g := New(time.Now().UnixNano())
+	uuidRegex := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	emailRegex := regexp.MustCompile(`^[a-z]+\.[a-z]+[0-9]*@[a-z.]+$`)
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 100; i++ {
+		if v := g.UUID(); !uuidRegex.MatchString(v) {
+			t.Errorf("UUID() = %s is not a valid v4 UUID", v)
+		}
+		if v := g.Email(); !emailRegex.MatchString(v) {
+			t.Errorf("Email() = %s is not a valid email", v)
+		}
+		if v := g.Int(-5, 5); v < -5 || v > 5 {
+			t.Errorf("Int(-5, 5) = %d is out of range", v)
+		}
+		if v := g.Float(1.5, 2.5); v < 1.5 || v >= 2.5 {
+			t.Errorf("Float(1.5, 2.5) = %f is out of range", v)
+		}
+		if v := g.Time(from, to); v.Before(from) || v.After(to) {
+			t.Errorf("Time() = %s is out of range", v)
+		}
+		if v := g.Pick("a", "b"); v != "a" && v != "b" {
+			t.Errorf("Pick() = %s is not one of the given values", v)
+		}
+	}
+}
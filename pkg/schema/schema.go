@@ -0,0 +1,487 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juan131/api-mock/pkg/fake"
+)
+
+const (
+	maxDepth          = 16 // maximum nesting depth of generated documents
+	defaultMaxItems   = 5  // maximum number of array items when not set in the schema
+	defaultMaxLength  = 24 // maximum string length when not set in the schema
+	defaultNumberSpan = 1000
+	maxUniqueAttempts = 10
+)
+
+// Schema is a JSON Schema document as decoded by encoding/json
+type Schema = map[string]interface{}
+
+// Generator synthesizes random documents conforming to a JSON Schema. It supports
+// types, enum, const, formats, numeric and length boundaries, required properties,
+// array items and local references ("$ref": "#/...").
+type Generator struct {
+	root Schema
+	fake *fake.Generator
+}
+
+// NewGenerator creates a generator for the given schema
+// backed by the given fake data generator
+func NewGenerator(root Schema, g *fake.Generator) *Generator {
+	return &Generator{root: root, fake: g}
+}
+
+// Generate returns a random document conforming to the schema
+func (gen *Generator) Generate() (interface{}, error) {
+	return gen.generate(gen.root, 0)
+}
+
+// generate returns a random value conforming to the given (sub)schema
+//
+//nolint:cyclop // one branch per JSON Schema keyword
+func (gen *Generator) generate(s Schema, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("maximum depth exceeded (recursive schema?)")
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		resolved, err := gen.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		return gen.generate(resolved, depth+1)
+	}
+	if v, ok := s["const"]; ok {
+		return v, nil
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[gen.fake.Intn(len(enum))], nil
+	}
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		merged, err := merge(s, allOf)
+		if err != nil {
+			return nil, err
+		}
+		return gen.generate(merged, depth+1)
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		if choices, ok := s[keyword].([]interface{}); ok && len(choices) > 0 {
+			choice, ok := choices[gen.fake.Intn(len(choices))].(Schema)
+			if !ok {
+				return nil, fmt.Errorf("%s items must be schemas", keyword)
+			}
+			return gen.generate(choice, depth+1)
+		}
+	}
+
+	switch typ := gen.schemaType(s); typ {
+	case "object":
+		return gen.generateObject(s, depth)
+	case "array":
+		return gen.generateArray(s, depth)
+	case "string":
+		return gen.generateString(s)
+	case "integer":
+		return gen.generateInteger(s)
+	case "number":
+		return gen.generateNumber(s)
+	case "boolean":
+		return gen.fake.Bool(), nil
+	case "null":
+		return nil, nil //nolint:nilnil // null is a valid JSON value
+	default:
+		return nil, fmt.Errorf("unsupported type %q", typ)
+	}
+}
+
+// schemaType returns the type of values to generate for the given schema,
+// picking one of them when several types are allowed and inferring it
+// from the schema keywords when not set
+func (gen *Generator) schemaType(s Schema) string {
+	switch typ := s["type"].(type) {
+	case string:
+		return typ
+	case []interface{}:
+		if len(typ) > 0 {
+			if t, ok := typ[gen.fake.Intn(len(typ))].(string); ok {
+				return t
+			}
+		}
+	}
+
+	return inferredType(s)
+}
+
+// inferredType returns the type of values to generate for a schema without type, inferred from its keywords
+func inferredType(s Schema) string {
+	switch {
+	case s["properties"] != nil || s["required"] != nil:
+		return "object"
+	case s["items"] != nil || s["prefixItems"] != nil:
+		return "array"
+	case s["minimum"] != nil || s["maximum"] != nil:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// resolve resolves a local reference (JSON pointer) against the root schema
+func (gen *Generator) resolve(ref string) (Schema, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local references are supported, got %q", ref)
+	}
+
+	var current interface{} = gen.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		obj, ok := current.(Schema)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+		if current, ok = obj[token]; !ok {
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+	}
+
+	resolved, ok := current.(Schema)
+	if !ok {
+		return nil, fmt.Errorf("reference %q is not a schema", ref)
+	}
+
+	return resolved, nil
+}
+
+// generateObject returns a random object including all the required
+// properties and a random subset of the optional ones
+func (gen *Generator) generateObject(s Schema, depth int) (interface{}, error) {
+	properties, _ := s["properties"].(Schema)
+	required := map[string]bool{}
+	if req, ok := s["required"].([]interface{}); ok {
+		for _, name := range req {
+			if n, ok := name.(string); ok {
+				required[n] = true
+			}
+		}
+	}
+
+	// Iterate properties in order so documents are reproducible for a given seed
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	obj := map[string]interface{}{}
+	for _, name := range names {
+		prop := properties[name]
+		// Skip optional properties randomly, and always when nested too deep
+		if !required[name] && (depth >= maxDepth/2 || gen.fake.Bool()) {
+			continue
+		}
+		propSchema, ok := prop.(Schema)
+		if !ok {
+			return nil, fmt.Errorf("property %q must be a schema", name)
+		}
+		v, err := gen.generate(propSchema, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("property %q: %w", name, err)
+		}
+		obj[name] = v
+	}
+
+	// Required properties without a definition accept any value
+	for _, name := range sortedKeys(required) {
+		if _, ok := obj[name]; !ok {
+			obj[name] = gen.fake.Word()
+		}
+	}
+
+	return obj, nil
+}
+
+// generateArray returns a random array respecting the items
+// schema, minItems, maxItems and uniqueItems keywords
+func (gen *Generator) generateArray(s Schema, depth int) (interface{}, error) {
+	items, prefixItems := arrayItems(s)
+	minItems, maxItems, err := itemCounts(s, items, prefixItems)
+	if err != nil {
+		return nil, err
+	}
+	n := gen.fake.Int(minItems, maxItems)
+	unique, _ := s["uniqueItems"].(bool)
+
+	arr := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		itemSchema := items
+		if i < len(prefixItems) {
+			itemSchema, _ = prefixItems[i].(Schema)
+		}
+		if itemSchema == nil {
+			itemSchema = Schema{}
+		}
+
+		var v interface{}
+		for attempt := 0; attempt < maxUniqueAttempts; attempt++ {
+			if v, err = gen.generate(itemSchema, depth+1); err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			if !unique || !containsValue(arr, v) {
+				break
+			}
+		}
+		if unique && containsValue(arr, v) {
+			break // not enough distinct values
+		}
+		arr = append(arr, v)
+	}
+
+	return arr, nil
+}
+
+// arrayItems returns the items schema and the prefix items (tuples) of an array schema
+func arrayItems(s Schema) (Schema, []interface{}) {
+	var prefixItems []interface{}
+	if p, ok := s["prefixItems"].([]interface{}); ok {
+		prefixItems = p
+	} else if p, ok := s["items"].([]interface{}); ok { // draft 4-7 tuples
+		prefixItems = p
+	}
+	items, _ := s["items"].(Schema)
+
+	return items, prefixItems
+}
+
+// itemCounts returns the minimum and maximum number of items of an array schema
+func itemCounts(s, items Schema, prefixItems []interface{}) (int, int, error) {
+	minItems := intKeyword(s, "minItems", len(prefixItems))
+	maxItems := intKeyword(s, "maxItems", max(minItems, len(prefixItems))+defaultMaxItems)
+	if items == nil && prefixItems != nil {
+		maxItems = min(maxItems, len(prefixItems))
+	}
+	if maxItems < minItems {
+		return 0, 0, fmt.Errorf("maxItems (%d) is lower than minItems (%d)", maxItems, minItems)
+	}
+
+	return minItems, maxItems, nil
+}
+
+// generateString returns a random string respecting the format, minLength and maxLength keywords
+func (gen *Generator) generateString(s Schema) (interface{}, error) {
+	switch format, _ := s["format"].(string); format {
+	case "email":
+		return gen.fake.Email(), nil
+	case "uuid":
+		return gen.fake.UUID(), nil
+	case "date":
+		return gen.fake.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).Format(time.DateOnly), nil
+	case "date-time":
+		return gen.fake.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).Format(time.RFC3339), nil
+	case "time":
+		return fmt.Sprintf("%02d:%02d:%02dZ", gen.fake.Intn(24), gen.fake.Intn(60), gen.fake.Intn(60)), nil
+	case "uri", "url", "iri":
+		return fmt.Sprintf("https://%s/%s", gen.hostname(), gen.fake.Word()), nil
+	case "hostname", "idn-hostname":
+		return gen.hostname(), nil
+	case "ipv4":
+		return fmt.Sprintf("%d.%d.%d.%d", gen.fake.Int(1, 254), gen.fake.Intn(256), gen.fake.Intn(256), gen.fake.Int(1, 254)), nil
+	case "ipv6":
+		return fmt.Sprintf("2001:db8::%x:%x", gen.fake.Intn(0x10000), gen.fake.Intn(0x10000)), nil
+	}
+
+	minLength, maxLength, err := stringLengths(s)
+	if err != nil {
+		return nil, err
+	}
+
+	str := gen.fake.Words(gen.fake.Int(1, 4))
+	for len(str) < minLength {
+		str += " " + gen.fake.Word()
+	}
+	if len(str) > maxLength {
+		str = strings.TrimSpace(str[:maxLength])
+		for len(str) < minLength {
+			str += "x"
+		}
+	}
+
+	return str, nil
+}
+
+// stringLengths returns the minimum and maximum length of a string schema
+func stringLengths(s Schema) (int, int, error) {
+	minLength := intKeyword(s, "minLength", 0)
+	maxLength := intKeyword(s, "maxLength", max(minLength, defaultMaxLength))
+	if maxLength < minLength {
+		return 0, 0, fmt.Errorf("maxLength (%d) is lower than minLength (%d)", maxLength, minLength)
+	}
+
+	return minLength, maxLength, nil
+}
+
+// generateInteger returns a random integer respecting the numeric boundaries and multipleOf keywords
+func (gen *Generator) generateInteger(s Schema) (interface{}, error) {
+	low, high, multipleOf, err := integerRange(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return int64(float64(gen.fake.Int(int(low), int(high))) * multipleOf), nil
+}
+
+// integerRange returns the range of integers of an integer schema as factors of the
+// returned multiple (1 unless multipleOf is set to a positive integer)
+func integerRange(s Schema) (float64, float64, float64, error) {
+	low, high := bounds(s)
+	low, high = math.Ceil(low), math.Floor(high)
+
+	if multipleOf, ok := s["multipleOf"].(float64); ok && multipleOf >= 1 && multipleOf == math.Trunc(multipleOf) {
+		lowFactor, highFactor := math.Ceil(low/multipleOf), math.Floor(high/multipleOf)
+		if highFactor < lowFactor {
+			return 0, 0, 0, fmt.Errorf("no multiple of %v between %v and %v", multipleOf, low, high)
+		}
+		return lowFactor, highFactor, multipleOf, nil
+	}
+	if high < low {
+		return 0, 0, 0, fmt.Errorf("no integer between %v and %v", low, high)
+	}
+
+	return low, high, 1, nil
+}
+
+// generateNumber returns a random number respecting the numeric boundaries keywords,
+// rounded to 2 decimals unless the rounded number falls out of the boundaries
+func (gen *Generator) generateNumber(s Schema) (interface{}, error) {
+	low, high, err := numberRange(s)
+	if err != nil {
+		return nil, err
+	}
+
+	// rounded before being clamped, so tight ranges are honored
+	return min(max(math.Round(gen.fake.Float(low, high)*100)/100, low), high), nil
+}
+
+// numberRange returns the range of numbers of a number schema
+func numberRange(s Schema) (float64, float64, error) {
+	low, high := bounds(s)
+	if high < low {
+		return 0, 0, fmt.Errorf("no number between %v and %v", low, high)
+	}
+
+	return low, high, nil
+}
+
+// bounds returns the inclusive numeric boundaries set in the schema, supporting both
+// the boolean (draft 4) and numeric (draft 6+) versions of the exclusive keywords,
+// whose inclusive boundary is the closest number to the exclusive one
+func bounds(s Schema) (float64, float64) {
+	low, hasLow := s["minimum"].(float64)
+	high, hasHigh := s["maximum"].(float64)
+	if v, ok := s["exclusiveMinimum"].(float64); ok {
+		low, hasLow = math.Nextafter(v, math.Inf(1)), true
+	} else if excl, _ := s["exclusiveMinimum"].(bool); excl && hasLow {
+		low = math.Nextafter(low, math.Inf(1))
+	}
+	if v, ok := s["exclusiveMaximum"].(float64); ok {
+		high, hasHigh = math.Nextafter(v, math.Inf(-1)), true
+	} else if excl, _ := s["exclusiveMaximum"].(bool); excl && hasHigh {
+		high = math.Nextafter(high, math.Inf(-1))
+	}
+
+	switch {
+	case !hasLow && !hasHigh:
+		low, high = 0, defaultNumberSpan
+	case !hasLow:
+		low = high - defaultNumberSpan
+	case !hasHigh:
+		high = low + defaultNumberSpan
+	}
+
+	return low, high
+}
+
+// hostname returns a random hostname
+func (gen *Generator) hostname() string {
+	return gen.fake.Word() + "." + gen.fake.Pick("example.com", "example.org", "example.net")
+}
+
+// merge merges the allOf subschemas into the parent schema
+func merge(parent Schema, allOf []interface{}) (Schema, error) {
+	merged := Schema{}
+	for k, v := range parent {
+		if k != "allOf" {
+			merged[k] = v
+		}
+	}
+
+	for _, item := range allOf {
+		sub, ok := item.(Schema)
+		if !ok {
+			return nil, errors.New("allOf items must be schemas")
+		}
+		for k, v := range sub {
+			switch k {
+			case "properties":
+				props, _ := merged["properties"].(Schema)
+				combined := Schema{}
+				for name, prop := range props {
+					combined[name] = prop
+				}
+				if subProps, ok := v.(Schema); ok {
+					for name, prop := range subProps {
+						combined[name] = prop
+					}
+				}
+				merged["properties"] = combined
+			case "required":
+				req, _ := merged["required"].([]interface{})
+				subReq, _ := v.([]interface{})
+				merged["required"] = append(append([]interface{}{}, req...), subReq...)
+			default:
+				merged[k] = v
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// intKeyword returns the value of an integer keyword, or the default value if not set
+func intKeyword(s Schema, keyword string, defaultValue int) int {
+	if v, ok := s[keyword].(float64); ok && v >= 0 {
+		return int(v)
+	}
+	return defaultValue
+}
+
+// sortedKeys returns the keys of the given set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsValue returns true if the slice contains a value equal to v
+func containsValue(values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if fmt.Sprint(value) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package schema
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/juan131/api-mock/pkg/fake"
+)
+
+const userSchema = `{
+	"$defs": {
+		"address": {
+			"type": "object",
+			"required": ["city", "zip"],
+			"properties": {
+				"city": {"type": "string", "minLength": 3, "maxLength": 10},
+				"zip": {"type": "string", "format": "uuid"}
+			}
+		}
+	},
+	"type": "object",
+	"required": ["id", "email", "role", "age", "score", "tags", "address", "active"],
+	"properties": {
+		"id": {"type": "integer", "minimum": 1, "maximum": 10, "multipleOf": 2},
+		"email": {"type": "string", "format": "email"},
+		"role": {"enum": ["admin", "user"]},
+		"age": {"type": "integer", "exclusiveMinimum": 17, "maximum": 99},
+		"score": {"type": "number", "minimum": 0.5, "exclusiveMaximum": 1},
+		"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 3},
+		"address": {"$ref": "#/$defs/address"},
+		"active": {"type": "boolean"},
+		"nickname": {"type": ["string", "null"]}
+	}
+}`
+
+func TestGenerator_Generate(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(userSchema), &s); err != nil {
+		t.Fatal(err)
+	}
+	gen := NewGenerator(s, fake.New(1))
+	uuidRegex := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	for i := 0; i < 50; i++ {
+		got, err := gen.Generate()
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		doc, ok := got.(map[string]interface{})
+		if !ok {
+			t.Fatalf("Generate() = %v, want an object", got)
+		}
+
+		if id, ok := doc["id"].(int64); !ok || id < 2 || id > 10 || id%2 != 0 {
+			t.Errorf("invalid id %v", doc["id"])
+		}
+		if email, ok := doc["email"].(string); !ok || !regexp.MustCompile(`^\S+@\S+$`).MatchString(email) {
+			t.Errorf("invalid email %v", doc["email"])
+		}
+		if role := doc["role"]; role != "admin" && role != "user" {
+			t.Errorf("invalid role %v", role)
+		}
+		if age, ok := doc["age"].(int64); !ok || age < 18 || age > 99 {
+			t.Errorf("invalid age %v", doc["age"])
+		}
+		if score, ok := doc["score"].(float64); !ok || score < 0.5 || score >= 1 {
+			t.Errorf("invalid score %v", doc["score"])
+		}
+		if tags, ok := doc["tags"].([]interface{}); !ok || len(tags) < 1 || len(tags) > 3 {
+			t.Errorf("invalid tags %v", doc["tags"])
+		}
+		if _, ok := doc["active"].(bool); !ok {
+			t.Errorf("invalid active %v", doc["active"])
+		}
+		if nickname, ok := doc["nickname"]; ok && nickname != nil {
+			if _, ok := nickname.(string); !ok {
+				t.Errorf("invalid nickname %v", nickname)
+			}
+		}
+		address, ok := doc["address"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("invalid address %v", doc["address"])
+		}
+		if city, ok := address["city"].(string); !ok || len(city) < 3 || len(city) > 10 {
+			t.Errorf("invalid city %q", address["city"])
+		}
+		if zip, ok := address["zip"].(string); !ok || !uuidRegex.MatchString(zip) {
+			t.Errorf("invalid zip %v", address["zip"])
+		}
+	}
+}
+
+func TestGenerator_Generate_deterministic(t *testing.T) {
+	var s Schema
+	if err := json.Unmarshal([]byte(userSchema), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	doc1, err := NewGenerator(s, fake.New(42)).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc2, err := NewGenerator(s, fake.New(42)).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(doc1, doc2) {
+		t.Errorf("expected the same document for the same seed, got %v and %v", doc1, doc2)
+	}
+}
+
+func TestGenerator_Generate_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{
+			name:   "unresolvable reference",
+			schema: `{"$ref": "#/definitions/missing"}`,
+		},
+		{
+			name:   "remote reference",
+			schema: `{"$ref": "https://example.com/schema.json"}`,
+		},
+		{
+			name:   "recursive schema",
+			schema: `{"$ref": "#"}`,
+		},
+		{
+			name:   "unsupported type",
+			schema: `{"type": "date"}`,
+		},
+		{
+			name:   "impossible boundaries",
+			schema: `{"type": "integer", "minimum": 10, "maximum": 1}`,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			var s Schema
+			if err := json.Unmarshal([]byte(test.schema), &s); err != nil {
+				tt.Fatal(err)
+			}
+			if _, err := NewGenerator(s, fake.New(1)).Generate(); err == nil {
+				tt.Errorf("Generate() expected an error")
+			}
+		})
+	}
+}
+
+func TestGenerator_Generate_tightRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		schema    string
+		low, high float64
+	}{
+		{
+			name:   "inclusive range below the rounding precision",
+			schema: `{"type": "number", "minimum": 0.001, "maximum": 0.004}`,
+			low:    0.001,
+			high:   0.004,
+		},
+		{
+			name:   "exclusive range below the rounding precision",
+			schema: `{"type": "number", "exclusiveMinimum": 0.001, "exclusiveMaximum": 0.002}`,
+			low:    0.001,
+			high:   0.002,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			var s Schema
+			if err := json.Unmarshal([]byte(test.schema), &s); err != nil {
+				tt.Fatal(err)
+			}
+			gen := NewGenerator(s, fake.New(1))
+			for i := 0; i < 50; i++ {
+				got, err := gen.Generate()
+				if err != nil {
+					tt.Fatalf("Generate() error = %v", err)
+				}
+				if n, ok := got.(float64); !ok || n < test.low || n > test.high {
+					tt.Fatalf("Generate() = %v, want a number between %v and %v", got, test.low, test.high)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// supportedTypes are the types of values the generator can generate
+	supportedTypes = map[string]bool{
+		"object": true, "array": true, "string": true, "integer": true, "number": true, "boolean": true, "null": true,
+	}
+	// stringFormats are the string formats the generator generates regardless of the string lengths
+	stringFormats = map[string]bool{
+		"email": true, "uuid": true, "date": true, "date-time": true, "time": true, "uri": true, "url": true,
+		"iri": true, "hostname": true, "idn-hostname": true, "ipv4": true, "ipv6": true,
+	}
+)
+
+// validator walks every branch of a schema checking documents can be generated from it
+type validator struct {
+	gen *Generator
+}
+
+// Validate checks documents can be generated from every branch of the schema (every oneOf
+// and anyOf choice, type, optional property and array item), so invalid schemas are detected
+// without depending on the branches taken by randomly generated documents.
+func Validate(root Schema) error {
+	v := &validator{gen: &Generator{root: root}}
+	return v.validate(root, 0, map[string]bool{}, map[string]bool{})
+}
+
+// validate checks the given (sub)schema at the given depth. Active are the references being
+// validated, forced those reached only through branches every generated document takes, which
+// make a recursive schema impossible to generate when referenced again.
+//
+//nolint:cyclop // one branch per JSON Schema keyword
+func (v *validator) validate(s Schema, depth int, active, forced map[string]bool) error {
+	if depth > maxDepth {
+		return errors.New("maximum depth exceeded")
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		resolved, err := v.gen.resolve(ref)
+		if err != nil {
+			return err
+		}
+		if forced[ref] {
+			return fmt.Errorf("recursive reference %q", ref)
+		}
+		if active[ref] {
+			// recursion ends as soon as an optional branch isn't taken
+			return nil
+		}
+		active[ref], forced[ref] = true, true
+		defer delete(active, ref)
+		defer delete(forced, ref)
+		return v.validate(resolved, depth+1, active, forced)
+	}
+	if _, ok := s["const"]; ok {
+		return nil
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && len(enum) > 0 {
+		return nil
+	}
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		merged, err := merge(s, allOf)
+		if err != nil {
+			return err
+		}
+		return v.validate(merged, depth+1, active, forced)
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		if choices, ok := s[keyword].([]interface{}); ok && len(choices) > 0 {
+			for i, c := range choices {
+				choice, ok := c.(Schema)
+				if !ok {
+					return fmt.Errorf("%s items must be schemas", keyword)
+				}
+				if err := v.validate(choice, depth+1, active, optional(choices, forced)); err != nil {
+					return fmt.Errorf("%s %d: %w", keyword, i, err)
+				}
+			}
+			return nil
+		}
+	}
+
+	types, err := schemaTypes(s)
+	if err != nil {
+		return err
+	}
+	for _, typ := range types {
+		var err error
+		switch typ {
+		case "object":
+			err = v.validateObject(s, depth, active, optional(types, forced))
+		case "array":
+			err = v.validateArray(s, depth, active, optional(types, forced))
+		case "string":
+			if format, _ := s["format"].(string); !stringFormats[format] {
+				_, _, err = stringLengths(s)
+			}
+		case "integer":
+			_, _, _, err = integerRange(s)
+		case "number":
+			_, _, err = numberRange(s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateObject checks the properties of an object schema, optional properties
+// being validated unless the generator always skips them at that depth
+func (v *validator) validateObject(s Schema, depth int, active, forced map[string]bool) error {
+	properties, _ := s["properties"].(Schema)
+	required := map[string]bool{}
+	if req, ok := s["required"].([]interface{}); ok {
+		for _, name := range req {
+			if n, ok := name.(string); ok {
+				required[n] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !required[name] && depth >= maxDepth/2 {
+			continue
+		}
+		propSchema, ok := properties[name].(Schema)
+		if !ok {
+			return fmt.Errorf("property %q must be a schema", name)
+		}
+		propForced := forced
+		if !required[name] {
+			propForced = map[string]bool{}
+		}
+		if err := v.validate(propSchema, depth+1, active, propForced); err != nil {
+			return fmt.Errorf("property %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateArray checks the item counts and the items of an array schema
+func (v *validator) validateArray(s Schema, depth int, active, forced map[string]bool) error {
+	items, prefixItems := arrayItems(s)
+	minItems, _, err := itemCounts(s, items, prefixItems)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range prefixItems {
+		prefixSchema, ok := p.(Schema)
+		if !ok {
+			return fmt.Errorf("item %d must be a schema", i)
+		}
+		itemForced := forced
+		if i >= minItems {
+			itemForced = map[string]bool{}
+		}
+		if err = v.validate(prefixSchema, depth+1, active, itemForced); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+	if items != nil {
+		itemsForced := forced
+		if minItems <= len(prefixItems) {
+			itemsForced = map[string]bool{}
+		}
+		if err = v.validate(items, depth+1, active, itemsForced); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// schemaTypes returns the types of values that can be generated for the given schema
+func schemaTypes(s Schema) ([]string, error) {
+	var types []string
+	switch typ := s["type"].(type) {
+	case nil:
+		types = []string{inferredType(s)}
+	case string:
+		types = []string{typ}
+	case []interface{}:
+		for _, t := range typ {
+			name, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type %v", t)
+			}
+			types = append(types, name)
+		}
+		if len(types) == 0 {
+			types = []string{inferredType(s)}
+		}
+	default:
+		return nil, fmt.Errorf("invalid type %v", typ)
+	}
+
+	for _, typ := range types {
+		if !supportedTypes[typ] {
+			return nil, fmt.Errorf("unsupported type %q", typ)
+		}
+	}
+
+	return types, nil
+}
+
+// optional returns the forced references of the branches of a choice, which are
+// optional (so none of them are forced anymore) if there's more than one branch
+func optional[T any](branches []T, forced map[string]bool) map[string]bool {
+	if len(branches) > 1 {
+		return map[string]bool{}
+	}
+
+	return forced
+}
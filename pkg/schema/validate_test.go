@@ -0,0 +1,76 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr bool
+	}{
+		{
+			name:   "valid schema",
+			schema: userSchema,
+		},
+		{
+			name:   "recursive schema ending in an optional property",
+			schema: `{"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "parent": {"$ref": "#"}}}`,
+		},
+		{
+			name:   "recursive schema ending in a oneOf choice",
+			schema: `{"$defs": {"node": {"oneOf": [{"type": "null"}, {"type": "array", "items": {"$ref": "#/$defs/node"}}]}}, "$ref": "#/$defs/node"}`,
+		},
+		{
+			name:    "recursive schema",
+			schema:  `{"type": "object", "required": ["parent"], "properties": {"parent": {"$ref": "#"}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid oneOf choice",
+			schema:  `{"oneOf": [{"type": "string"}, {"type": "integer", "minimum": 10, "maximum": 1}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid anyOf choice",
+			schema:  `{"anyOf": [{"type": "string"}, {"$ref": "#/$defs/missing"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid optional property",
+			schema:  `{"type": "object", "properties": {"name": {"type": "string", "minLength": 5, "maxLength": 1}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported type among several",
+			schema:  `{"type": ["string", "date"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid array items",
+			schema:  `{"type": "array", "prefixItems": [{"type": "string"}], "items": {"type": "number", "exclusiveMinimum": 1, "exclusiveMaximum": 1}}`,
+			wantErr: true,
+		},
+		{
+			name:    "impossible item counts",
+			schema:  `{"type": "array", "items": {"type": "string"}, "minItems": 3, "maxItems": 1}`,
+			wantErr: true,
+		},
+	}
+	t.Parallel()
+	for _, testToRun := range tests {
+		test := testToRun
+		t.Run(test.name, func(tt *testing.T) {
+			tt.Parallel()
+			var s Schema
+			if err := json.Unmarshal([]byte(test.schema), &s); err != nil {
+				tt.Fatal(err)
+			}
+			if err := Validate(s); (err != nil) != test.wantErr {
+				tt.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}